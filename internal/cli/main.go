@@ -3,14 +3,25 @@ package cli
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/umatare5/controld-exporter/internal/collector"
 	"github.com/umatare5/controld-exporter/internal/config"
+	"github.com/umatare5/controld-exporter/internal/controld"
 	"github.com/umatare5/controld-exporter/internal/log"
 	"github.com/umatare5/controld-exporter/internal/server"
 	cli "github.com/urfave/cli/v3"
 )
 
+const (
+	defaultControlDTimeout    = 30 * time.Second // Default timeout of each request to the Control D API
+	defaultWebShutdownTimeout = 15 * time.Second // Default time to drain the in-flight requests on shutdown
+)
+
 // Run initializes and starts the CLI application.
 func Run() {
 	cmd := &cli.Command{
@@ -21,11 +32,16 @@ func Run() {
 		Flags:     registerFlags(),
 		Action: func(ctx context.Context, cli *cli.Command) error {
 			config := config.NewConfig(cli)
-			exporter, _ := server.NewServer(&config)
+			exporter, err := server.NewServer(&config)
+			if err != nil {
+				return err
+			}
 
-			exporter.Start()
+			// Shut down gracefully on SIGINT or SIGTERM.
+			ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+			defer stop()
 
-			return nil
+			return exporter.Start(ctx)
 		},
 	}
 
@@ -37,15 +53,44 @@ func Run() {
 // registerFlags defines and returns the global CLI flags.
 func registerFlags() []cli.Flag {
 	flags := []cli.Flag{}
+	flags = append(flags, registerConfigFileFlag()...)
 	flags = append(flags, registerWebListenAddressFlag()...)
 	flags = append(flags, registerWebListenPortFlag()...)
 	flags = append(flags, registerWebTelemetryPathFlag()...)
+	flags = append(flags, registerWebConfigFileFlag()...)
+	flags = append(flags, registerWebShutdownTimeoutFlag()...)
 	flags = append(flags, registerAPIKeyFlag()...)
+	flags = append(flags, registerAPIKeyFileFlag()...)
+	flags = append(flags, registerModeFlag()...)
 	flags = append(flags, registerBusinessModeFlag()...)
+	flags = append(flags, registerAPIURLFlag()...)
+	flags = append(flags, registerAnalyticsURLFlag()...)
+	flags = append(flags, registerProxyURLFlag()...)
+	flags = append(flags, registerUserAgentFlag()...)
+	flags = append(flags, registerTimeoutFlag()...)
+	flags = append(flags, registerRetryMaxAttemptsFlag()...)
+	flags = append(flags, registerRetryMaxElapsedFlag()...)
+	flags = append(flags, registerRateLimitFlags()...)
 	flags = append(flags, registerLogLevelFlag()...)
+	flags = append(flags, registerMaxConcurrencyFlag()...)
+	flags = append(flags, registerTopFlags()...)
+	flags = append(flags, registerClientLimitFlag()...)
+	flags = append(flags, registerCollectorFlags()...)
+	flags = append(flags, registerRefreshIntervalFlags()...)
+	flags = append(flags, registerProbeConfigFileFlag()...)
 	return flags
 }
 
+// registerConfigFileFlag defines the flag for the path to the configuration file.
+func registerConfigFileFlag() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  config.ConfigFileFlagName,
+			Usage: "Path to the YAML or TOML configuration file. Flags and environment variables take precedence over it.",
+		},
+	}
+}
+
 // registerWebListenAddressFlag defines the flag for the server's listen address.
 func registerWebListenAddressFlag() []cli.Flag {
 	return []cli.Flag{
@@ -80,15 +125,56 @@ func registerWebTelemetryPathFlag() []cli.Flag {
 	}
 }
 
+// registerWebConfigFileFlag defines the flag for the file configuring TLS and authentication of the HTTP server.
+func registerWebConfigFileFlag() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  config.WebConfigFileFlagName,
+			Usage: "Path to the exporter-toolkit web configuration file to enable TLS or authentication.",
+		},
+	}
+}
+
+// registerWebShutdownTimeoutFlag defines the flag for the time to drain the in-flight requests on shutdown.
+func registerWebShutdownTimeoutFlag() []cli.Flag {
+	return []cli.Flag{
+		&cli.DurationFlag{
+			Name:  config.WebShutdownTimeoutFlagName,
+			Usage: "Time to wait for the in-flight requests to complete on SIGINT or SIGTERM.",
+			Value: defaultWebShutdownTimeout,
+		},
+	}
+}
+
 // registerAPIKeyFlag defines the flag for the Control D API key.
 func registerAPIKeyFlag() []cli.Flag {
 	return []cli.Flag{
 		&cli.StringFlag{
-			Name:     config.ControlDAPIKeyFlagName,
-			Usage:    "API key for authenticating with the Control D API.",
-			Aliases:  []string{"k"},
-			Sources:  cli.EnvVars("CTRLD_API_KEY"),
-			Required: true,
+			Name:    config.ControlDAPIKeyFlagName,
+			Usage:   "API key for authenticating with the Control D API.",
+			Aliases: []string{"k"},
+			Sources: cli.EnvVars("CTRLD_API_KEY"),
+		},
+	}
+}
+
+// registerAPIKeyFileFlag defines the flag for the file holding the Control D API key.
+func registerAPIKeyFileFlag() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  config.ControlDAPIKeyFileFlagName,
+			Usage: "Path to the file holding the API key for the Control D API. The file is re-read when it changes.",
+		},
+	}
+}
+
+// registerModeFlag defines the flag for the mode of the collection.
+func registerModeFlag() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  config.ControlDModeFlagName,
+			Usage: "Mode of the collection: personal, business, or auto to detect a business organization from the API key.",
+			Value: config.PersonalMode,
 		},
 	}
 }
@@ -98,12 +184,114 @@ func registerBusinessModeFlag() []cli.Flag {
 	return []cli.Flag{
 		&cli.BoolFlag{
 			Name:  config.ControlDBusinessModeFlagName,
-			Usage: "Enable the metrics collection available in the business subscription.",
+			Usage: "Deprecated: use --" + config.ControlDModeFlagName + " business instead.",
 			Value: false,
 		},
 	}
 }
 
+// registerAPIURLFlag defines the flag for the base URL of the Control D API.
+func registerAPIURLFlag() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  config.ControlDAPIURLFlagName,
+			Usage: "Base URL of the Control D API.",
+			Value: controld.DefaultBaseURL,
+		},
+	}
+}
+
+// registerAnalyticsURLFlag defines the flag for the URL template of the Control D Analytics API.
+func registerAnalyticsURLFlag() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  config.ControlDAnalyticsURLFlagName,
+			Usage: "URL template of the Control D Analytics API. " + controld.AnalyticsURLPlaceholder + " is replaced with the stats endpoint.",
+			Value: controld.DefaultAnalyticsURL,
+		},
+	}
+}
+
+// registerProxyURLFlag defines the flag for the proxy used to reach the Control D API.
+func registerProxyURLFlag() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  config.ControlDProxyURLFlagName,
+			Usage: "URL of the HTTP proxy used to reach the Control D API. Defaults to the proxy environment variables.",
+		},
+	}
+}
+
+// registerUserAgentFlag defines the flag for the User-Agent header sent to the Control D API.
+func registerUserAgentFlag() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  config.ControlDUserAgentFlagName,
+			Usage: "User-Agent header sent with each request to the Control D API.",
+			Value: controld.DefaultUserAgent + "/" + getVersion(),
+		},
+	}
+}
+
+// registerTimeoutFlag defines the flag for the timeout of each request to the Control D API.
+func registerTimeoutFlag() []cli.Flag {
+	return []cli.Flag{
+		&cli.DurationFlag{
+			Name:  config.ControlDTimeoutFlagName,
+			Usage: "Timeout of each request to the Control D API.",
+			Value: defaultControlDTimeout,
+		},
+	}
+}
+
+// registerRetryMaxAttemptsFlag defines the flag for the maximum number of attempts of each request.
+func registerRetryMaxAttemptsFlag() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:  config.ControlDRetryMaxAttemptsFlagName,
+			Usage: "Maximum number of attempts of each request to the Control D API. Set 1 to disable retries.",
+			Value: controld.DefaultRetryPolicy.MaxAttempts,
+		},
+	}
+}
+
+// registerRetryMaxElapsedFlag defines the flag for the time budget of all attempts of each request.
+func registerRetryMaxElapsedFlag() []cli.Flag {
+	return []cli.Flag{
+		&cli.DurationFlag{
+			Name:  config.ControlDRetryMaxElapsedFlagName,
+			Usage: "Time budget of all attempts of each request to the Control D API.",
+			Value: controld.DefaultRetryPolicy.MaxElapsed,
+		},
+	}
+}
+
+// registerRateLimitFlags defines the flags for the rate limits of the Control D API and Analytics API.
+func registerRateLimitFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.FloatFlag{
+			Name:  config.ControlDRateLimitFlagName,
+			Usage: "Maximum number of requests per second to the Control D API. Set 0 to disable the limit.",
+			Value: controld.DefaultRateLimit.RequestsPerSecond,
+		},
+		&cli.IntFlag{
+			Name:  config.ControlDRateBurstFlagName,
+			Usage: "Maximum number of requests sent at once to the Control D API.",
+			Value: controld.DefaultRateLimit.Burst,
+		},
+		&cli.FloatFlag{
+			Name:  config.ControlDAnalyticsRateLimitFlagName,
+			Usage: "Maximum number of requests per second to the Control D Analytics API. Set 0 to disable the limit.",
+			Value: controld.DefaultRateLimit.RequestsPerSecond,
+		},
+		&cli.IntFlag{
+			Name:  config.ControlDAnalyticsRateBurstFlagName,
+			Usage: "Maximum number of requests sent at once to the Control D Analytics API.",
+			Value: controld.DefaultRateLimit.Burst,
+		},
+	}
+}
+
 // registerLogLevelFlag defines the flag for setting the logging level.
 func registerLogLevelFlag() []cli.Flag {
 	return []cli.Flag{
@@ -114,3 +302,85 @@ func registerLogLevelFlag() []cli.Flag {
 		},
 	}
 }
+
+// registerMaxConcurrencyFlag defines the flag for the number of requests for sub-organizations sent at once.
+func registerMaxConcurrencyFlag() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:  config.CollectorMaxConcurrencyFlagName,
+			Usage: "Maximum number of requests for sub-organizations sent at once across all collector modules.",
+			Value: collector.DefaultMaxConcurrency,
+		},
+	}
+}
+
+// registerTopFlags defines the flags for the rankings of the stats_top collector module.
+func registerTopFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.DurationFlag{
+			Name:  config.CollectorTopWindowFlagName,
+			Usage: "Period of the rankings of the stats_top collector module, ending at the last closed minute.",
+			Value: collector.DefaultTopWindow,
+		},
+		&cli.IntFlag{
+			Name:  config.CollectorTopLimitFlagName,
+			Usage: fmt.Sprintf("Number of entries exported per ranking of the stats_top collector module, up to %d.", collector.MaxTopLimit),
+			Value: collector.DefaultTopLimit,
+		},
+		&cli.StringFlag{
+			Name:  config.CollectorTopDomainIncludeFlagName,
+			Usage: "Regular expression of the domains ranked by the stats_top collector module. All domains are ranked when empty.",
+		},
+		&cli.StringFlag{
+			Name:  config.CollectorTopDomainExcludeFlagName,
+			Usage: "Regular expression of the domains left out of the rankings of the stats_top collector module.",
+		},
+	}
+}
+
+// registerClientLimitFlag defines the flag for the number of clients exported per device by the endpoint_clients collector module.
+func registerClientLimitFlag() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:  config.CollectorClientLimitFlagName,
+			Usage: fmt.Sprintf("Number of clients seen most recently exported per device by the endpoint_clients collector module, up to %d.", collector.MaxClientLimit),
+			Value: collector.DefaultClientLimit,
+		},
+	}
+}
+
+// registerCollectorFlags defines the flags to enable or disable each collector module.
+func registerCollectorFlags() []cli.Flag {
+	flags := []cli.Flag{}
+	for _, module := range config.CollectorModules {
+		flags = append(flags, &cli.BoolWithInverseFlag{
+			Name:  config.CollectorFlagName(module),
+			Usage: "Enable the " + module + " collector module.",
+			Value: !config.IsOptInCollectorModule(module),
+		})
+	}
+	return flags
+}
+
+// registerProbeConfigFileFlag defines the flag for the file defining the targets of the probe endpoint.
+func registerProbeConfigFileFlag() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  config.ProbeConfigFileFlagName,
+			Usage: "Path to the YAML or TOML file defining the accounts served by the /probe endpoint.",
+		},
+	}
+}
+
+// registerRefreshIntervalFlags defines the flags for the polling interval of each collector module.
+func registerRefreshIntervalFlags() []cli.Flag {
+	flags := []cli.Flag{}
+	for _, module := range config.CollectorModules {
+		flags = append(flags, &cli.DurationFlag{
+			Name:  config.RefreshIntervalFlagName(module),
+			Usage: "Interval to poll the Control D API for the " + module + " metrics. Set 0 to call the API on every scrape.",
+			Value: config.DefaultRefreshInterval(module),
+		})
+	}
+	return flags
+}
@@ -2,6 +2,8 @@
 package collector
 
 import (
+	"context"
+	"errors"
 	"strings"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -13,22 +15,25 @@ const (
 )
 
 // collectBillingMetrics collects billing-related metrics.
-func (c *Collector) collectBillingMetrics(ch chan<- prometheus.Metric) {
-	c.collectBillingPayments(ch)
-	c.collectBillingSubscriptions(ch)
+func (c *Collector) collectBillingMetrics(ctx context.Context, ch chan<- prometheus.Metric) error {
+	return errors.Join(
+		c.collectBillingPayments(ctx, ch),
+		c.collectBillingSubscriptions(ctx, ch),
+	)
 }
 
 // collectBillingPayments collects metrics for billing payments.
-func (c *Collector) collectBillingPayments(ch chan<- prometheus.Metric) {
-	payments, err := c.client.GetBillingPayments()
+func (c *Collector) collectBillingPayments(ctx context.Context, ch chan<- prometheus.Metric) error {
+	payments, err := c.client.GetBillingPayments(ctx)
+	recordScrape(ctx, dummyOrgId, err)
 	if err != nil {
 		c.log.error(billingPaymentsLogPrefix, errFetchingMetrics+"%v", err)
-		return
+		return err
 	}
 
 	if isPaymentsEmpty(payments) {
 		c.log.warn(billingPaymentsLogPrefix, warnSkipEmptyData+"%v", payments)
-		return
+		return nil
 	}
 
 	for _, payment := range payments.Body.Payments {
@@ -62,19 +67,22 @@ func (c *Collector) collectBillingPayments(ch chan<- prometheus.Metric) {
 			strings.ToUpper(payment.Currency),
 		)
 	}
+
+	return nil
 }
 
 // collectBillingSubscriptions collects metrics for billing subscriptions.
-func (c *Collector) collectBillingSubscriptions(ch chan<- prometheus.Metric) {
-	subscriptions, err := c.client.GetBillingSubscriptions()
+func (c *Collector) collectBillingSubscriptions(ctx context.Context, ch chan<- prometheus.Metric) error {
+	subscriptions, err := c.client.GetBillingSubscriptions(ctx)
+	recordScrape(ctx, dummyOrgId, err)
 	if err != nil {
 		c.log.error(billingSubscriptionsLogPrefix, errFetchingMetrics+"%v", err)
-		return
+		return err
 	}
 
 	if isSubscriptionsEmpty(subscriptions) {
 		c.log.warn(billingPaymentsLogPrefix, warnSkipEmptyData+"%v", subscriptions)
-		return
+		return nil
 	}
 
 	for _, subscription := range subscriptions.Body.Subscriptions {
@@ -85,4 +93,6 @@ func (c *Collector) collectBillingSubscriptions(ch chan<- prometheus.Metric) {
 			subscription.PK,
 		)
 	}
+
+	return nil
 }
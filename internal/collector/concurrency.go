@@ -0,0 +1,133 @@
+// Package collector contains Prometheus metric collectors for the exporter.
+package collector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultMaxConcurrency is the default number of requests for sub-organizations sent at once.
+const DefaultMaxConcurrency = 4
+
+// sharedFetch caches the result of an API call and shares a single in-flight call between concurrent callers.
+type sharedFetch[T any] struct {
+	mu        sync.Mutex    // Mutex to protect access to the cached result and the call in flight
+	ttl       time.Duration // Duration for which the cached result is served, or zero to serve it until refreshed
+	cached    *T            // Last result fetched successfully
+	fetchedAt time.Time     // Time when the cached result was fetched
+	call      *fetchCall[T] // Call in flight, if any
+}
+
+// fetchCall is an API call whose result is shared by every caller waiting for it.
+type fetchCall[T any] struct {
+	done  chan struct{} // Closed when the call has completed
+	value *T            // Result of the call
+	err   error         // Error of the call
+}
+
+// get returns the cached result, or fetches it when nothing has been fetched successfully yet or the result has expired.
+func (f *sharedFetch[T]) get(ctx context.Context, fetch func(ctx context.Context) (*T, error)) (*T, error) {
+	f.mu.Lock()
+	if f.cached != nil && (f.ttl == 0 || time.Since(f.fetchedAt) < f.ttl) {
+		cached := f.cached
+		f.mu.Unlock()
+		return cached, nil
+	}
+	return f.join(ctx, fetch)
+}
+
+// refresh fetches the result again and replaces the cached result on success.
+// A call already in flight is joined instead of starting another one.
+func (f *sharedFetch[T]) refresh(ctx context.Context, fetch func(ctx context.Context) (*T, error)) (*T, error) {
+	f.mu.Lock()
+	return f.join(ctx, fetch)
+}
+
+// join waits for the call in flight, or starts a new one when none is in flight.
+// The mutex must be held by the caller and is released before returning.
+func (f *sharedFetch[T]) join(ctx context.Context, fetch func(ctx context.Context) (*T, error)) (*T, error) {
+	if call := f.call; call != nil {
+		f.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.value, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	call := &fetchCall[T]{done: make(chan struct{})}
+	f.call = call
+	f.mu.Unlock()
+
+	call.value, call.err = fetch(ctx)
+
+	f.mu.Lock()
+	if call.err == nil {
+		f.cached, f.fetchedAt = call.value, time.Now()
+	}
+	f.call = nil
+	f.mu.Unlock()
+	close(call.done)
+
+	return call.value, call.err
+}
+
+// workerPool bounds the number of requests sent at once across every module.
+type workerPool chan struct{}
+
+// newWorkerPool returns a pool with the given number of workers, or the default number when it is not positive.
+func newWorkerPool(size int) workerPool {
+	if size <= 0 {
+		size = DefaultMaxConcurrency
+	}
+	return make(workerPool, size)
+}
+
+// acquire waits for a free worker. It returns false when the context is done first.
+func (p workerPool) acquire(ctx context.Context) bool {
+	select {
+	case p <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release returns the worker to the pool.
+func (p workerPool) release() {
+	<-p
+}
+
+// forEachSubOrg runs fn for each sub-organization concurrently, bounded by the worker pool, and returns their errors joined.
+// No more sub-organizations are started once the context is done.
+func (c *Collector) forEachSubOrg(ctx context.Context, subOrgIDs []string, fn func(subOrgID string) error) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+
+	for _, subOrgID := range subOrgIDs {
+		if isContextDone(ctx) || !c.workers.acquire(ctx) {
+			recordSubOrgsFailure(ctx, ctx.Err())
+			errs = append(errs, ctx.Err())
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer c.workers.release()
+			if err := fn(subOrgID); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,138 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingFetch returns a fetch returning the value, and the number of times it was called.
+func countingFetch(value int, err error) (func(ctx context.Context) (*int, error), *atomic.Int32) {
+	calls := &atomic.Int32{}
+	return func(ctx context.Context) (*int, error) {
+		calls.Add(1)
+		if err != nil {
+			return nil, err
+		}
+		return &value, nil
+	}, calls
+}
+
+func TestSharedFetchGet(t *testing.T) {
+	cached := 1
+	tests := []struct {
+		name      string
+		ttl       time.Duration
+		cached    *int
+		fetchedAt time.Time
+		fetchErr  error
+		want      int
+		wantErr   bool
+		wantCalls int32
+	}{
+		{name: "nothing cached", ttl: time.Hour, want: 2, wantCalls: 1},
+		{name: "cached within the ttl", ttl: time.Hour, cached: &cached, fetchedAt: time.Now(), want: 1},
+		{name: "expired after the ttl", ttl: time.Hour, cached: &cached, fetchedAt: time.Now().Add(-2 * time.Hour), want: 2, wantCalls: 1},
+		{name: "no ttl", cached: &cached, fetchedAt: time.Now().Add(-24 * time.Hour), want: 1},
+		{name: "failed fetch", ttl: time.Hour, fetchErr: errors.New("unavailable"), wantErr: true, wantCalls: 1},
+		{name: "failed fetch after the ttl", ttl: time.Hour, cached: &cached, fetchedAt: time.Now().Add(-2 * time.Hour), fetchErr: errors.New("unavailable"), wantErr: true, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &sharedFetch[int]{ttl: tt.ttl, cached: tt.cached, fetchedAt: tt.fetchedAt}
+			fetch, calls := countingFetch(2, tt.fetchErr)
+
+			got, err := f.get(context.Background(), fetch)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && *got != tt.want {
+				t.Errorf("get() = %d, want %d", *got, tt.want)
+			}
+			if calls.Load() != tt.wantCalls {
+				t.Errorf("fetch calls = %d, want %d", calls.Load(), tt.wantCalls)
+			}
+			if tt.fetchErr != nil && f.cached != tt.cached {
+				t.Error("failed fetch replaced the cached result")
+			}
+		})
+	}
+}
+
+func TestSharedFetchConcurrentCallers(t *testing.T) {
+	const callers = 10
+
+	f := &sharedFetch[int]{ttl: time.Hour}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	calls := &atomic.Int32{}
+	fetch := func(ctx context.Context) (*int, error) {
+		if calls.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		value := 1
+		return &value, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*int, callers)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0], _ = f.get(context.Background(), fetch)
+	}()
+	<-started
+	for i := 1; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = f.get(context.Background(), fetch)
+		}()
+	}
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("fetch calls = %d, want 1", calls.Load())
+	}
+	for i, result := range results {
+		if result != results[0] {
+			t.Errorf("caller %d got %v, want the result of the shared fetch %v", i, result, results[0])
+		}
+	}
+}
+
+func TestSharedFetchJoinCancelled(t *testing.T) {
+	f := &sharedFetch[int]{}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = f.refresh(context.Background(), func(ctx context.Context) (*int, error) {
+			close(started)
+			<-release
+			return nil, errors.New("unavailable")
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := f.refresh(ctx, func(ctx context.Context) (*int, error) {
+		t.Error("refresh() started a second fetch while one was in flight")
+		return nil, nil
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("refresh() error = %v, want %v", err, context.Canceled)
+	}
+	close(release)
+	<-done
+}
@@ -2,6 +2,9 @@
 package collector
 
 import (
+	"context"
+	"errors"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/umatare5/controld-exporter/internal/controld"
 )
@@ -11,61 +14,68 @@ const (
 )
 
 // collectEndpointMetrics collects endpoint-related metrics.
-func (c *Collector) collectEndpointMetrics(ch chan<- prometheus.Metric) {
+func (c *Collector) collectEndpointMetrics(ctx context.Context, ch chan<- prometheus.Metric) error {
 	if c.isRunningInPersonalMode() {
-		c.collectPersonalEndpointMetrics(ch)
 		c.log.debug(endpointLogPrefix, logSkipOrgScraping)
-		return
+		return c.collectPersonalEndpointMetrics(ctx, ch)
 	}
 
 	// Organization metrics are only available in business mode.
-	org, err := c.fetchMainOrganization()
+	org, err := c.fetchMainOrganization(ctx)
 	if err != nil {
 		c.log.info(endpointLogPrefix, logNotFoundMainOrg)
-		return
+		return err
 	}
-	c.collectMainOrgEndpointMetrics(ch, org)
+	mainErr := c.collectMainOrgEndpointMetrics(ctx, ch, org)
 
-	subOrgs, err := c.fetchSubOrganizations()
+	subOrgs, err := c.fetchSubOrganizations(ctx)
 	if err != nil {
+		recordSubOrgsFailure(ctx, err)
 		c.log.info(endpointLogPrefix, logNotFoundSubOrgs)
-		return
+		return errors.Join(mainErr, err)
 	}
-	c.collectSubOrgEndpointMetrics(ch, subOrgs)
+	subErr := c.collectSubOrgEndpointMetrics(ctx, ch, subOrgs)
+
+	return errors.Join(mainErr, subErr)
 }
 
 // collectPersonalEndpointMetrics collects metrics for endpoints in the personal instance.
-func (c *Collector) collectPersonalEndpointMetrics(ch chan<- prometheus.Metric) {
-	endpoints, err := c.client.GetDevices()
+func (c *Collector) collectPersonalEndpointMetrics(ctx context.Context, ch chan<- prometheus.Metric) error {
+	endpoints, err := c.client.GetDevices(ctx)
+	recordScrape(ctx, dummyOrgId, err)
 	if err != nil {
 		c.log.error(endpointLogPrefix, errFetchingPersonalMetrics+"%v", err)
-		return
+		return err
 	}
 
 	c.storeEndpointMetrics(ch, endpoints, dummyOrgId)
+	return nil
 }
 
 // collectMainOrgEndpointMetrics collects metrics for endpoints in the main organization.
-func (c *Collector) collectMainOrgEndpointMetrics(ch chan<- prometheus.Metric, org *controld.OrganizationResponse) {
-	endpoints, err := c.client.GetDevices()
+func (c *Collector) collectMainOrgEndpointMetrics(ctx context.Context, ch chan<- prometheus.Metric, org *controld.OrganizationResponse) error {
+	endpoints, err := c.client.GetDevices(ctx)
+	recordScrape(ctx, org.Body.Organization.PK, err)
 	if err != nil {
 		c.log.error(endpointLogPrefix, errFetchingMainOrgMetrics+"%v", err)
-		return
+		return err
 	}
 	c.storeEndpointMetrics(ch, endpoints, org.Body.Organization.PK)
+	return nil
 }
 
 // collectSubOrgEndpointMetrics collects metrics for endpoints in sub organizations.
-func (c *Collector) collectSubOrgEndpointMetrics(ch chan<- prometheus.Metric, subOrgs *controld.SubOrganizationsResponse) {
-	subOrgIDs := extractSubOrganizationIDs(subOrgs)
-	for _, subOrgID := range subOrgIDs {
-		endpoints, err := c.client.GetSubOrgDevices(subOrgID)
+func (c *Collector) collectSubOrgEndpointMetrics(ctx context.Context, ch chan<- prometheus.Metric, subOrgs *controld.SubOrganizationsResponse) error {
+	return c.forEachSubOrg(ctx, extractSubOrganizationIDs(subOrgs), func(subOrgID string) error {
+		endpoints, err := c.client.GetSubOrgDevices(ctx, subOrgID)
+		recordScrape(ctx, subOrgID, err)
 		if err != nil {
 			c.log.error(endpointLogPrefix, errFetchingSubOrgMetrics+"%s: %v", subOrgID, err)
-			continue
+			return err
 		}
 		c.storeEndpointMetrics(ch, endpoints, subOrgID)
-	}
+		return nil
+	})
 }
 
 // storeEndpointMetrics stores endpoint metrics in the Prometheus channel.
@@ -80,8 +90,66 @@ func (c *Collector) storeEndpointMetrics(ch chan<- prometheus.Metric, endpoints
 			controld_endpoint_clients_total,
 			prometheus.GaugeValue,
 			float64(endpoint.ClientCount),
+			endpoint.PK,
 			endpoint.Name,
 			orgID,
 		)
+		ch <- prometheus.MustNewConstMetric(
+			controld_endpoint_status,
+			prometheus.GaugeValue,
+			float64(endpoint.Status),
+			endpoint.PK,
+			endpoint.Name,
+			orgID,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			controld_endpoint_info,
+			prometheus.GaugeValue,
+			1,
+			endpoint.PK,
+			endpoint.Name,
+			endpoint.Ctrld.Version,
+			orgID,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			controld_endpoint_profile_info,
+			prometheus.GaugeValue,
+			1,
+			endpoint.PK,
+			endpoint.Name,
+			endpoint.Profile.PK,
+			endpoint.Profile.Name,
+			orgID,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			controld_endpoint_ip_total,
+			prometheus.GaugeValue,
+			float64(endpoint.IPCount),
+			endpoint.PK,
+			endpoint.Name,
+			orgID,
+		)
+
+		// The timestamps are zero until the device has been used, or when it runs no ctrld agent.
+		if endpoint.LastActivity > 0 {
+			ch <- prometheus.MustNewConstMetric(
+				controld_endpoint_last_activity_timestamp_seconds,
+				prometheus.GaugeValue,
+				float64(endpoint.LastActivity),
+				endpoint.PK,
+				endpoint.Name,
+				orgID,
+			)
+		}
+		if endpoint.Ctrld.LastFetch > 0 {
+			ch <- prometheus.MustNewConstMetric(
+				controld_endpoint_ctrld_last_fetch_timestamp_seconds,
+				prometheus.GaugeValue,
+				float64(endpoint.Ctrld.LastFetch),
+				endpoint.PK,
+				endpoint.Name,
+				orgID,
+			)
+		}
 	}
 }
@@ -0,0 +1,177 @@
+// Package collector contains Prometheus metric collectors for the exporter.
+package collector
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/umatare5/controld-exporter/internal/controld"
+)
+
+const (
+	endpointClientsLogPrefix = "endpoint_clients"
+	unknownClientOS          = "unknown" // OS label of the clients whose OS is not detected
+)
+
+// Defaults and limits of the endpoint_clients module.
+const (
+	DefaultClientLimit = 50   // Default number of clients exported per device
+	MaxClientLimit     = 1000 // Hard cap of the number of clients exported per device
+)
+
+// endpointClient is a client of a device with the labels exported for it.
+type endpointClient struct {
+	host     string // Hostname of the client
+	mac      string // MAC address of the client
+	os       string // Operating system of the client
+	lastSeen int    // Unix time of the last DNS query of the client
+}
+
+// collectEndpointClientsMetrics collects the metrics of the clients of each device.
+func (c *Collector) collectEndpointClientsMetrics(ctx context.Context, ch chan<- prometheus.Metric) error {
+	if c.isRunningInPersonalMode() {
+		c.log.debug(endpointClientsLogPrefix, logSkipOrgScraping)
+		return c.collectPersonalEndpointClientsMetrics(ctx, ch)
+	}
+
+	// Organization metrics are only available in business mode.
+	org, err := c.fetchMainOrganization(ctx)
+	if err != nil {
+		c.log.info(endpointClientsLogPrefix, logNotFoundMainOrg)
+		return err
+	}
+	mainErr := c.collectMainOrgEndpointClientsMetrics(ctx, ch, org)
+
+	subOrgs, err := c.fetchSubOrganizations(ctx)
+	if err != nil {
+		recordSubOrgsFailure(ctx, err)
+		c.log.info(endpointClientsLogPrefix, logNotFoundSubOrgs)
+		return errors.Join(mainErr, err)
+	}
+	subErr := c.collectSubOrgEndpointClientsMetrics(ctx, ch, subOrgs)
+
+	return errors.Join(mainErr, subErr)
+}
+
+// collectPersonalEndpointClientsMetrics collects the metrics of the clients of each device in the personal instance.
+func (c *Collector) collectPersonalEndpointClientsMetrics(ctx context.Context, ch chan<- prometheus.Metric) error {
+	devices, err := c.client.GetDevices(ctx)
+	recordScrape(ctx, dummyOrgId, err)
+	if err != nil {
+		c.log.error(endpointClientsLogPrefix, errFetchingPersonalMetrics+"%v", err)
+		return err
+	}
+
+	c.storeEndpointClientsMetrics(ch, devices, dummyOrgId)
+	return nil
+}
+
+// collectMainOrgEndpointClientsMetrics collects the metrics of the clients of each device in the main organization.
+func (c *Collector) collectMainOrgEndpointClientsMetrics(ctx context.Context, ch chan<- prometheus.Metric, org *controld.OrganizationResponse) error {
+	devices, err := c.client.GetDevices(ctx)
+	recordScrape(ctx, org.Body.Organization.PK, err)
+	if err != nil {
+		c.log.error(endpointClientsLogPrefix, errFetchingMainOrgMetrics+"%v", err)
+		return err
+	}
+
+	c.storeEndpointClientsMetrics(ch, devices, org.Body.Organization.PK)
+	return nil
+}
+
+// collectSubOrgEndpointClientsMetrics collects the metrics of the clients of each device in sub organizations.
+func (c *Collector) collectSubOrgEndpointClientsMetrics(ctx context.Context, ch chan<- prometheus.Metric, subOrgs *controld.SubOrganizationsResponse) error {
+	return c.forEachSubOrg(ctx, extractSubOrganizationIDs(subOrgs), func(subOrgID string) error {
+		devices, err := c.client.GetSubOrgDevices(ctx, subOrgID)
+		recordScrape(ctx, subOrgID, err)
+		if err != nil {
+			c.log.error(endpointClientsLogPrefix, errFetchingSubOrgMetrics+"%s: %v", subOrgID, err)
+			return err
+		}
+		c.storeEndpointClientsMetrics(ch, devices, subOrgID)
+		return nil
+	})
+}
+
+// storeEndpointClientsMetrics stores the metrics of the clients of each device in the Prometheus channel.
+// Only the clients seen most recently are exported up to the limit, while the clients by OS count every client.
+// A client listed more than once is exported and counted once, with its most recent timestamp.
+func (c *Collector) storeEndpointClientsMetrics(ch chan<- prometheus.Metric, devices *controld.DevicesResponse, orgID string) {
+	if isDevicesEmpty(devices) {
+		return
+	}
+
+	for _, device := range devices.Body.Devices {
+		clients := []endpointClient{}
+		for _, client := range device.Clients {
+			clients = append(clients, endpointClient{host: client.Host, mac: client.MAC, os: clientOS(client.OS), lastSeen: client.Timestamp})
+		}
+
+		// Keep the clients seen most recently, so that the stale ones are dropped first.
+		slices.SortFunc(clients, func(a, b endpointClient) int {
+			return cmp.Or(cmp.Compare(b.lastSeen, a.lastSeen), cmp.Compare(a.mac, b.mac), cmp.Compare(a.host, b.host))
+		})
+		clients = distinctClients(clients)
+		if len(clients) > c.clientLimit {
+			c.log.debug(endpointClientsLogPrefix, logDroppedClients+"%s: %d", device.Name, len(clients)-c.clientLimit)
+		}
+
+		clientsByOS := map[string]int{}
+		for i, client := range clients {
+			clientsByOS[client.os]++
+			if i >= c.clientLimit {
+				continue
+			}
+
+			ch <- prometheus.MustNewConstMetric(
+				controld_endpoint_client_last_seen_timestamp_seconds,
+				prometheus.GaugeValue,
+				float64(client.lastSeen),
+				device.PK,
+				device.Name,
+				client.host,
+				client.mac,
+				client.os,
+				orgID,
+			)
+		}
+
+		for os, count := range clientsByOS {
+			ch <- prometheus.MustNewConstMetric(
+				controld_endpoint_clients_by_os,
+				prometheus.GaugeValue,
+				float64(count),
+				device.PK,
+				device.Name,
+				os,
+				orgID,
+			)
+		}
+	}
+}
+
+// distinctClients returns the clients without the ones listed again with the same host, MAC and OS, keeping the order.
+func distinctClients(clients []endpointClient) []endpointClient {
+	distinct := []endpointClient{}
+	seen := map[endpointClient]bool{}
+	for _, client := range clients {
+		key := endpointClient{host: client.host, mac: client.mac, os: client.os}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		distinct = append(distinct, client)
+	}
+	return distinct
+}
+
+// clientOS returns the OS family of the client, which is the first OS detected.
+func clientOS(os []string) string {
+	if len(os) == 0 || os[0] == "" {
+		return unknownClientOS
+	}
+	return os[0]
+}
@@ -0,0 +1,80 @@
+package collector
+
+import (
+	"encoding/json"
+	"maps"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/umatare5/controld-exporter/internal/controld"
+)
+
+// devicesBody lists the device dev1 with clients a and b, client a being listed twice.
+const devicesBody = `{"success":true,"body":{"devices":[{"PK":"dev1","name":"Router","clients":{
+	"id1":{"ts":100,"host":"a","mac":"00:00:00:00:00:0a","os":["Linux"]},
+	"id2":{"ts":300,"host":"a","mac":"00:00:00:00:00:0a","os":["Linux"]},
+	"id3":{"ts":200,"host":"b","mac":"00:00:00:00:00:0b","os":["Windows"]},
+	"id4":{"ts":50,"host":"c","mac":"00:00:00:00:00:0c","os":["Linux"]}
+}}]}}`
+
+// labelValues returns the value of each metric of the description by the value of the label.
+func labelValues(t *testing.T, metrics []prometheus.Metric, desc *prometheus.Desc, label string) map[string]float64 {
+	t.Helper()
+
+	values := map[string]float64{}
+	for _, metric := range metrics {
+		if metric.Desc() != desc {
+			continue
+		}
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		for _, pair := range m.GetLabel() {
+			if pair.GetName() == label {
+				values[pair.GetValue()] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	return values
+}
+
+func TestStoreEndpointClientsMetrics(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		wantSeen map[string]float64
+	}{
+		{name: "every client", limit: 10, wantSeen: map[string]float64{"a": 300, "b": 200, "c": 50}},
+		{name: "duplicate client does not count toward the limit", limit: 3, wantSeen: map[string]float64{"a": 300, "b": 200, "c": 50}},
+		{name: "limit below the clients", limit: 2, wantSeen: map[string]float64{"a": 300, "b": 200}},
+		{name: "limit of one client", limit: 1, wantSeen: map[string]float64{"a": 300}},
+	}
+
+	var devices controld.DevicesResponse
+	if err := json.Unmarshal([]byte(devicesBody), &devices); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Collector{clientLimit: tt.limit}
+			ch := make(chan prometheus.Metric, 16)
+			c.storeEndpointClientsMetrics(ch, &devices, dummyOrgId)
+			close(ch)
+			metrics := []prometheus.Metric{}
+			for metric := range ch {
+				metrics = append(metrics, metric)
+			}
+
+			if got := labelValues(t, metrics, controld_endpoint_client_last_seen_timestamp_seconds, "client_host"); !maps.Equal(got, tt.wantSeen) {
+				t.Errorf("controld_endpoint_client_last_seen_timestamp_seconds = %v, want %v", got, tt.wantSeen)
+			}
+			wantByOS := map[string]float64{"Linux": 2, "Windows": 1}
+			if got := labelValues(t, metrics, controld_endpoint_clients_by_os, "os"); !maps.Equal(got, wantByOS) {
+				t.Errorf("controld_endpoint_clients_by_os = %v, want %v", got, wantByOS)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+// Package collector contains Prometheus metric collectors for the exporter.
+package collector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// scrapeResultsKey is the context key of the scrapeResults of a module run.
+type scrapeResultsKey struct{}
+
+// scrapeResults holds the outcome of each organization scraped during a module run.
+type scrapeResults struct {
+	mu         sync.Mutex
+	success    map[string]bool // Whether every API call succeeded, by organization ID
+	incomplete bool            // Whether some sub-organizations were not listed or not reached
+}
+
+// moduleStatus holds the outcome of the last run of a module.
+type moduleStatus struct {
+	duration time.Duration   // Duration of the last run
+	success  map[string]bool // Whether every API call succeeded, by organization ID
+}
+
+// withScrapeResults returns a context in which the outcome of each organization can be recorded.
+func withScrapeResults(ctx context.Context) (context.Context, *scrapeResults) {
+	results := &scrapeResults{success: map[string]bool{}}
+	return context.WithValue(ctx, scrapeResultsKey{}, results), results
+}
+
+// recordScrape records the outcome of an API call made for the organization.
+// An organization is successful only if every call made for it succeeded.
+func recordScrape(ctx context.Context, orgID string, err error) {
+	results, ok := ctx.Value(scrapeResultsKey{}).(*scrapeResults)
+	if !ok {
+		return
+	}
+
+	results.mu.Lock()
+	defer results.mu.Unlock()
+
+	success, seen := results.success[orgID]
+	results.success[orgID] = (success || !seen) && err == nil
+}
+
+// recordSubOrgsFailure records that the sub-organizations could not all be collected, because they could not be listed
+// or the run stopped before reaching them. The failure is recorded with the placeholder organization ID rather than
+// against the main organization, whose metrics were collected, and the previous metrics of the sub-organizations which
+// were not reached are kept.
+func recordSubOrgsFailure(ctx context.Context, err error) {
+	results, ok := ctx.Value(scrapeResultsKey{}).(*scrapeResults)
+	if !ok {
+		return
+	}
+	recordScrape(ctx, dummyOrgId, err)
+
+	results.mu.Lock()
+	defer results.mu.Unlock()
+
+	results.incomplete = true
+}
+
+// failed checks if an API call made for the organization failed.
+// The caller must hold the lock.
+func (r *scrapeResults) failed(orgID string) bool {
+	success, seen := r.success[orgID]
+	return seen && !success
+}
+
+// anySucceeded checks if every API call made for at least one organization succeeded.
+func (r *scrapeResults) anySucceeded() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, success := range r.success {
+		if success {
+			return true
+		}
+	}
+	return false
+}
+
+// storeModuleStatus keeps the outcome of the module run for the self-metrics.
+// When the run failed before recording any organization, the failure is recorded with the placeholder organization ID.
+func (c *Collector) storeModuleStatus(name string, duration time.Duration, results *scrapeResults, err error) {
+	results.mu.Lock()
+	defer results.mu.Unlock()
+
+	if err != nil && len(results.success) == 0 {
+		results.success[dummyOrgId] = false
+	}
+
+	c.statusesMu.Lock()
+	defer c.statusesMu.Unlock()
+
+	c.statuses[name] = &moduleStatus{duration: duration, success: results.success}
+}
+
+// collectExporterMetrics collects metrics about the exporter itself.
+// These metrics are read on every scrape instead of being polled in the background.
+func (c *Collector) collectExporterMetrics(ch chan<- prometheus.Metric, selected map[string]bool) {
+	c.collectModuleStatusMetrics(ch, selected)
+	c.collectAPIRequestMetrics(ch)
+}
+
+// collectModuleStatusMetrics collects the outcome and the duration of the last run of each selected module.
+func (c *Collector) collectModuleStatusMetrics(ch chan<- prometheus.Metric, selected map[string]bool) {
+	c.statusesMu.RLock()
+	defer c.statusesMu.RUnlock()
+
+	for name, status := range c.statuses {
+		if !isSelected(selected, name) {
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			controld_exporter_scrape_duration_seconds,
+			prometheus.GaugeValue,
+			status.duration.Seconds(),
+			name,
+		)
+
+		for orgID, success := range status.success {
+			ch <- prometheus.MustNewConstMetric(
+				controld_exporter_scrape_success,
+				prometheus.GaugeValue,
+				boolToFloat64(success),
+				name,
+				orgID,
+			)
+		}
+	}
+}
+
+// collectAPIRequestMetrics collects the counters of the requests sent to the Control D API.
+func (c *Collector) collectAPIRequestMetrics(ch chan<- prometheus.Metric) {
+	stats := c.client.Stats()
+
+	for key, count := range stats.Requests() {
+		ch <- prometheus.MustNewConstMetric(
+			controld_exporter_api_requests_total,
+			prometheus.CounterValue,
+			float64(count),
+			key.Endpoint,
+			key.Code,
+		)
+	}
+
+	for endpoint, count := range stats.Retries() {
+		ch <- prometheus.MustNewConstMetric(
+			controld_exporter_api_retries_total,
+			prometheus.CounterValue,
+			float64(count),
+			endpoint,
+		)
+	}
+}
+
+// boolToFloat64 converts the boolean into a metric value.
+func boolToFloat64(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
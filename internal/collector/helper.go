@@ -2,13 +2,45 @@
 package collector
 
 import (
+	"context"
+	"errors"
+	"net/http"
+
 	"github.com/umatare5/controld-exporter/internal/controld"
 )
 
 const (
-	dummyOrgId = "000000000" // Placeholder for the personal instance
+	dummyOrgId            = "000000000" // Placeholder for the personal instance
+	personalStatsEndpoint = "america"   // Stats endpoint queried for the personal instance
 )
 
+// isContextDone checks if the context has been canceled or its deadline has been exceeded.
+func isContextDone(ctx context.Context) bool {
+	return ctx.Err() != nil
+}
+
+// isNotEntitled checks if the error indicates that the plan of the account does not include the endpoint.
+func isNotEntitled(err error) bool {
+	var forbidden *controld.ForbiddenError
+	return errors.As(err, &forbidden)
+}
+
+// isNoOrganization checks if the API answered a request for the organization with a refusal, which it does when the
+// account has none: 403 Forbidden, 404 Not Found or a successful status with "success" set to false.
+// Unlike a rejected API key, a rate limit, a server error or a transport error, it tells that the account is personal.
+func isNoOrganization(err error) bool {
+	var apiErr *controld.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.Status {
+	case http.StatusForbidden, http.StatusNotFound:
+		return true
+	default:
+		return apiErr.Status < http.StatusBadRequest
+	}
+}
+
 // isDevicesEmpty checks if the devices array in the response is empty.
 func isDevicesEmpty(devices *controld.DevicesResponse) bool {
 	return isEmpty(devices) || isEmpty(devices.Body.Devices)
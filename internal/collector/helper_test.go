@@ -0,0 +1,44 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/umatare5/controld-exporter/internal/controld"
+)
+
+func TestErrorClassification(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		notEntitled bool
+		noOrg       bool
+	}{
+		{name: "forbidden", err: &controld.ForbiddenError{APIError: controld.APIError{Status: 403}}, notEntitled: true, noOrg: true},
+		{name: "unauthorized", err: &controld.UnauthorizedError{APIError: controld.APIError{Status: 401}}},
+		{name: "not found", err: &controld.NotFoundError{APIError: controld.APIError{Status: 404}}, noOrg: true},
+		{name: "failure reported with 200", err: &controld.APIError{Status: 200}, noOrg: true},
+		{name: "other API error", err: &controld.APIError{Status: 400}},
+		{name: "server error", err: &controld.ServerError{APIError: controld.APIError{Status: 503}}},
+		{name: "rate limited", err: &controld.RateLimitedError{APIError: controld.APIError{Status: 429}}},
+		{name: "transport error", err: errors.New("connection refused")},
+		{name: "deadline exceeded", err: context.DeadlineExceeded},
+		{name: "wrapped forbidden", err: fmt.Errorf("sub-organization: %w", &controld.ForbiddenError{APIError: controld.APIError{Status: 403}}), notEntitled: true, noOrg: true},
+		{name: "joined forbidden", err: errors.Join(&controld.ForbiddenError{APIError: controld.APIError{Status: 403}}), notEntitled: true, noOrg: true},
+		{name: "wrapped not found", err: fmt.Errorf("organization: %w", &controld.NotFoundError{APIError: controld.APIError{Status: 404}}), noOrg: true},
+		{name: "decode error", err: &controld.DecodeError{Endpoint: controld.OrganizationEndpoint, Err: errors.New("unexpected EOF")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isNotEntitled(tt.err); got != tt.notEntitled {
+				t.Errorf("isNotEntitled() = %v, want %v", got, tt.notEntitled)
+			}
+			if got := isNoOrganization(tt.err); got != tt.noOrg {
+				t.Errorf("isNoOrganization() = %v, want %v", got, tt.noOrg)
+			}
+		})
+	}
+}
@@ -11,6 +11,19 @@ const (
 	errFetchingMainOrgMetrics  = "Error fetching metrics for main organization: "
 	errFetchingSubOrgMetrics   = "Error fetching metrics for sub organization ID: "
 	warnSkipEmptyData          = "Skipping empty data: "
+	warnKeepLastSnapshot       = "Keeping the last snapshot because the refresh failed for module: "
+	warnKeepFailedOrgs         = "Keeping the last metrics of the organizations which failed to refresh for module: "
+	warnScrapeFailed           = "Failed to collect on scrape for module: "
+	logModuleNotEntitled       = "The plan of the account is not entitled to module: "
+	logRefreshedSnapshot       = "Refreshed the snapshot for module: "
+	logDetectedBusinessMode    = "Detected a business organization. Collecting in business mode."
+	logDetectedPersonalMode    = "Detected no business organization. Collecting in personal mode."
+	warnModeDetectionFailed    = "Failed to detect the mode, keeping the current one: "
+	logAwaitModeDetection      = "Skipping the collection until the mode is detected for module: "
+	warnSkipStatsBuckets       = "Skipped the DNS queries older than the backfill limit for organization ID: "
+	warnInvalidStatsBucket     = "Skipping the DNS queries of a bucket with an invalid timestamp: "
+	logDroppedClients          = "Dropped the clients seen least recently beyond the limit for device: "
+	warnInvalidTrialEnd        = "Skipping the trial end with an invalid timestamp for organization ID: "
 )
 
 type logger struct{}
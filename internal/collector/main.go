@@ -2,7 +2,10 @@
 package collector
 
 import (
+	"context"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/umatare5/controld-exporter/internal/controld"
@@ -13,6 +16,39 @@ const (
 	subsystem = ""
 )
 
+// Names of the collector modules.
+const (
+	OrganizationModule    = "organization"
+	BillingModule         = "billing"
+	EndpointModule        = "endpoint"
+	EndpointClientsModule = "endpoint_clients"
+	NetworkModule         = "network"
+	ProfileModule         = "profile"
+	ServiceModule         = "service"
+	StatsModule           = "stats"
+	StatsTopModule        = "stats_top"
+)
+
+// ModuleInfo describes a collector module to the configuration.
+type ModuleInfo struct {
+	Name            string        // Name of the module
+	OptIn           bool          // Whether the module is disabled unless enabled explicitly, as it sends many requests
+	RefreshInterval time.Duration // Default interval between two refreshes
+}
+
+// Modules lists the collector modules in the order they are collected.
+var Modules = []ModuleInfo{
+	{Name: OrganizationModule, RefreshInterval: 5 * time.Minute},
+	{Name: BillingModule, RefreshInterval: time.Hour},
+	{Name: EndpointModule, RefreshInterval: time.Minute},
+	{Name: EndpointClientsModule, OptIn: true, RefreshInterval: 5 * time.Minute},
+	{Name: NetworkModule, RefreshInterval: time.Minute},
+	{Name: ProfileModule, RefreshInterval: 5 * time.Minute},
+	{Name: ServiceModule, RefreshInterval: 5 * time.Minute},
+	{Name: StatsModule, RefreshInterval: time.Minute},
+	{Name: StatsTopModule, OptIn: true, RefreshInterval: 5 * time.Minute},
+}
+
 // Metrics descriptions
 var (
 	controld_billing_status = prometheus.NewDesc(
@@ -46,7 +82,63 @@ var (
 	controld_endpoint_clients_total = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "endpoint", "clients_total"),
 		"Number of clients connected to a device.",
-		[]string{"name", "orgId"},
+		[]string{"device_id", "name", "orgId"},
+		nil,
+	)
+
+	controld_endpoint_status = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "endpoint", "status"),
+		"Status of a device as reported by the Control D API.",
+		[]string{"device_id", "name", "orgId"},
+		nil,
+	)
+
+	controld_endpoint_last_activity_timestamp_seconds = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "endpoint", "last_activity_timestamp_seconds"),
+		"Unix time of the last DNS query of a device.",
+		[]string{"device_id", "name", "orgId"},
+		nil,
+	)
+
+	controld_endpoint_ctrld_last_fetch_timestamp_seconds = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "endpoint", "ctrld_last_fetch_timestamp_seconds"),
+		"Unix time of the last configuration fetch of the ctrld agent running on a device.",
+		[]string{"device_id", "name", "orgId"},
+		nil,
+	)
+
+	controld_endpoint_info = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "endpoint", "info"),
+		"Information about a device, such as the version of its ctrld agent.",
+		[]string{"device_id", "name", "ctrld_version", "orgId"},
+		nil,
+	)
+
+	controld_endpoint_ip_total = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "endpoint", "ip_total"),
+		"Number of IP addresses associated with a device.",
+		[]string{"device_id", "name", "orgId"},
+		nil,
+	)
+
+	controld_endpoint_client_last_seen_timestamp_seconds = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "endpoint", "client_last_seen_timestamp_seconds"),
+		"Unix time of the last DNS query of a client of a device.",
+		[]string{"device_id", "device", "client_host", "mac", "os", "orgId"},
+		nil,
+	)
+
+	controld_endpoint_clients_by_os = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "endpoint", "clients_by_os"),
+		"Number of clients of a device by operating system.",
+		[]string{"device_id", "device", "os", "orgId"},
+		nil,
+	)
+
+	controld_endpoint_profile_info = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "endpoint", "profile_info"),
+		"Profile applied to a device, to join the metrics of the device with the ones of the profile.",
+		[]string{"device_id", "device", "profile_id", "profile", "orgId"},
 		nil,
 	)
 
@@ -60,49 +152,49 @@ var (
 	controld_profile_content_filters_total = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "profile", "content_filters_total"),
 		"Number of content filters applied to the profile.",
-		[]string{"name", "orgId"},
+		[]string{"profile_id", "name", "orgId"},
 		nil,
 	)
 
 	controld_profile_enabled_option_total = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "profile", "enabled_option_total"),
 		"Number of enabled options in the profile.",
-		[]string{"name", "orgId"},
+		[]string{"profile_id", "name", "orgId"},
 		nil,
 	)
 
 	controld_profile_groups_total = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "profile", "groups_total"),
 		"Number of group filters applied to the profile.",
-		[]string{"name", "orgId"},
+		[]string{"profile_id", "name", "orgId"},
 		nil,
 	)
 
 	controld_profile_ip_filters_total = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "profile", "ip_filters_total"),
 		"Number of IP filters applied to the profile.",
-		[]string{"name", "orgId"},
+		[]string{"profile_id", "name", "orgId"},
 		nil,
 	)
 
 	controld_profile_preset_filters_total = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "profile", "preset_filters_total"),
 		"Number of preset filters applied to the profile.",
-		[]string{"name", "orgId"},
+		[]string{"profile_id", "name", "orgId"},
 		nil,
 	)
 
 	controld_profile_rules_total = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "profile", "rules_total"),
 		"Number of rules applied to the profile.",
-		[]string{"name", "orgId"},
+		[]string{"profile_id", "name", "orgId"},
 		nil,
 	)
 
 	controld_profile_services_total = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "profile", "services_total"),
 		"Number of service filters applied to the profile.",
-		[]string{"name", "orgId"},
+		[]string{"profile_id", "name", "orgId"},
 		nil,
 	)
 
@@ -115,11 +207,53 @@ var (
 
 	controld_stats_last_queries_count = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "stats", "last_queries_count"),
-		"Count of DNS queries by type (redirect, success, blocked).",
+		"Deprecated: use controld_dns_queries_total. Count of DNS queries by type in the last closed minute.",
 		[]string{"type", "orgId"},
 		nil,
 	)
 
+	controld_dns_queries_total = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "dns", "queries_total"),
+		"Number of DNS queries by verdict since the exporter started.",
+		[]string{"verdict", "orgId"},
+		nil,
+	)
+
+	controld_dns_queries_by_country_total = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "dns", "queries_by_country_total"),
+		"Number of DNS queries by destination country since the exporter started.",
+		[]string{"country", "orgId"},
+		nil,
+	)
+
+	controld_dns_queries_by_protocol_total = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "dns", "queries_by_protocol_total"),
+		"Number of DNS queries by protocol, such as doh, dot, doq or legacy, since the exporter started.",
+		[]string{"protocol", "orgId"},
+		nil,
+	)
+
+	controld_top_blocked_domains = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "top", "blocked_domains"),
+		"Number of blocked DNS queries of the most blocked domains over the window.",
+		[]string{"domain", "rank", "orgId"},
+		nil,
+	)
+
+	controld_top_filters = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "top", "filters"),
+		"Number of DNS queries blocked by the filters blocking the most over the window.",
+		[]string{"filter", "rank", "orgId"},
+		nil,
+	)
+
+	controld_top_services = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "top", "services"),
+		"Number of DNS queries of the services queried the most over the window.",
+		[]string{"service", "rank", "orgId"},
+		nil,
+	)
+
 	controld_organization_members_total = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "organization", "members_total"),
 		"Number of members in an organization.",
@@ -155,6 +289,90 @@ var (
 		nil,
 	)
 
+	controld_organization_profiles_max = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "organization", "profiles_max"),
+		"Maximum number of profiles allowed in an organization.",
+		[]string{"name", "orgId"},
+		nil,
+	)
+
+	controld_organization_users_max = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "organization", "users_max"),
+		"Maximum number of users allowed in an organization.",
+		[]string{"name", "orgId"},
+		nil,
+	)
+
+	controld_organization_routers_max = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "organization", "routers_max"),
+		"Maximum number of routers allowed in an organization.",
+		[]string{"name", "orgId"},
+		nil,
+	)
+
+	controld_organization_sub_orgs_max = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "organization", "sub_orgs_max"),
+		"Maximum number of sub-organizations allowed in an organization.",
+		[]string{"name", "orgId"},
+		nil,
+	)
+
+	controld_organization_legacy_resolvers_max = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "organization", "legacy_resolvers_max"),
+		"Maximum number of legacy resolvers allowed in an organization.",
+		[]string{"name", "orgId"},
+		nil,
+	)
+
+	controld_organization_user_price = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "organization", "user_price"),
+		"Price per user of an organization.",
+		[]string{"name", "orgId"},
+		nil,
+	)
+
+	controld_organization_router_price = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "organization", "router_price"),
+		"Price per router of an organization.",
+		[]string{"name", "orgId"},
+		nil,
+	)
+
+	controld_organization_info = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "organization", "info"),
+		"Status and billing method of an organization.",
+		[]string{"name", "status", "billing_method", "orgId"},
+		nil,
+	)
+
+	controld_organization_twofa_required = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "organization", "twofa_required"),
+		"Whether two-factor authentication is required for the members of an organization.",
+		[]string{"name", "orgId"},
+		nil,
+	)
+
+	controld_organization_siem_enabled = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "organization", "siem_enabled"),
+		"Whether SIEM integration is enabled for an organization.",
+		[]string{"name", "orgId"},
+		nil,
+	)
+
+	controld_organization_sso_enabled = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "organization", "sso_enabled"),
+		"Whether single sign-on is enabled for an organization, by provider.",
+		[]string{"name", "provider", "orgId"},
+		nil,
+	)
+
+	controld_organization_trial_end_timestamp_seconds = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "organization", "trial_end_timestamp_seconds"),
+		"Unix time of the end of the trial of an organization.",
+		[]string{"name", "orgId"},
+		nil,
+	)
+
 	controld_sub_organization_members_total = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "sub_organization", "members_total"),
 		"Number of members in a sub-organization.",
@@ -182,25 +400,176 @@ var (
 		[]string{"name", "orgId"},
 		nil,
 	)
+
+	controld_sub_organization_profiles_max = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sub_organization", "profiles_max"),
+		"Maximum number of profiles allowed in a sub-organization.",
+		[]string{"name", "orgId"},
+		nil,
+	)
+
+	controld_sub_organization_users_max = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sub_organization", "users_max"),
+		"Maximum number of users allowed in a sub-organization.",
+		[]string{"name", "orgId"},
+		nil,
+	)
+
+	controld_sub_organization_routers_max = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sub_organization", "routers_max"),
+		"Maximum number of routers allowed in a sub-organization.",
+		[]string{"name", "orgId"},
+		nil,
+	)
+
+	controld_sub_organization_legacy_resolvers_max = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sub_organization", "legacy_resolvers_max"),
+		"Maximum number of legacy resolvers allowed in a sub-organization.",
+		[]string{"name", "orgId"},
+		nil,
+	)
+
+	controld_sub_organization_user_price = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sub_organization", "user_price"),
+		"Price per user of a sub-organization.",
+		[]string{"name", "orgId"},
+		nil,
+	)
+
+	controld_sub_organization_router_price = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sub_organization", "router_price"),
+		"Price per router of a sub-organization.",
+		[]string{"name", "orgId"},
+		nil,
+	)
+
+	controld_sub_organization_info = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sub_organization", "info"),
+		"Status and billing method of a sub-organization.",
+		[]string{"name", "status", "billing_method", "orgId"},
+		nil,
+	)
+
+	controld_sub_organization_twofa_required = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sub_organization", "twofa_required"),
+		"Whether two-factor authentication is required for the members of a sub-organization.",
+		[]string{"name", "orgId"},
+		nil,
+	)
+
+	controld_sub_organization_siem_enabled = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sub_organization", "siem_enabled"),
+		"Whether SIEM integration is enabled for a sub-organization.",
+		[]string{"name", "orgId"},
+		nil,
+	)
+
+	controld_sub_organization_allow_overrides = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sub_organization", "allow_overrides"),
+		"Whether a sub-organization is allowed to override the settings of its parent organization.",
+		[]string{"name", "orgId"},
+		nil,
+	)
+
+	controld_exporter_scrape_success = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "exporter", "scrape_success"),
+		"Whether the last run of a collector module succeeded for an organization.",
+		[]string{"module", "orgId"},
+		nil,
+	)
+
+	controld_exporter_scrape_duration_seconds = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "exporter", "scrape_duration_seconds"),
+		"Duration of the last run of a collector module.",
+		[]string{"module"},
+		nil,
+	)
+
+	controld_exporter_api_requests_total = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "exporter", "api_requests_total"),
+		"Number of requests sent to the Control D API by endpoint and HTTP status code.",
+		[]string{"endpoint", "code"},
+		nil,
+	)
+
+	controld_exporter_api_retries_total = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "exporter", "api_retries_total"),
+		"Number of requests to the Control D API which were retried.",
+		[]string{"endpoint"},
+		nil,
+	)
 )
 
+// Options holds the settings which control how the collector gathers metrics.
+type Options struct {
+	Mode             string                   // One of PersonalMode, BusinessMode or AutoMode; personal mode when empty
+	RefreshIntervals map[string]time.Duration // Polling interval for each module, or zero to collect on every scrape
+	EnabledModules   map[string]bool          // Whether each module is enabled; modules missing from the map are enabled
+	MaxConcurrency   int                      // Maximum number of requests for sub-organizations sent at once
+	Top              TopOptions               // Settings of the stats_top module
+	ClientLimit      int                      // Maximum number of clients exported per device by the endpoint_clients module
+}
+
 // Collector is responsible for collecting metrics from ControlD.
 type Collector struct {
-	client              *controld.Client                   // ControlD API client
-	organizations       *controld.OrganizationResponse     // Cached organization data
-	organizationsMu     sync.Mutex                         // Mutex to protect access to the cached data for main-organization
-	subOrganizations    *controld.SubOrganizationsResponse // Cached sub-organization data
-	subOrganizationsMu  sync.Mutex                         // Mutex to protect access to the cached data for sub-organization
-	businessModeEnabled bool                               // Indicates if business features is enabled
-	log                 *logger
+	client                 *controld.Client                               // ControlD API client
+	organizations          sharedFetch[controld.OrganizationResponse]     // Cached organization data
+	subOrganizations       sharedFetch[controld.SubOrganizationsResponse] // Cached sub-organization data
+	mode                   string                                         // One of PersonalMode, BusinessMode or AutoMode
+	businessAccount        atomic.Bool                                    // Whether the API key belongs to a business organization, as detected
+	modeDetected           atomic.Bool                                    // Whether businessAccount has been detected
+	workers                workerPool                                     // Bounds the requests for sub-organizations sent at once
+	modules                []*module                                      // Modules refreshed in the background
+	snapshots              map[string][]prometheus.Metric                 // Last good metrics gathered by each module
+	snapshotsMu            sync.RWMutex                                   // Mutex to protect access to the snapshots
+	statuses               map[string]*moduleStatus                       // Outcome of the last run of each module
+	statusesMu             sync.RWMutex                                   // Mutex to protect access to the statuses
+	collected              atomic.Bool                                    // Whether a module has been collected successfully
+	orgQueryCounters       queryCounters                                  // DNS queries of each organization counted by the stats module
+	breakdownQueryCounters queryCounters                                  // DNS queries of each organization counted by country and by protocol by the stats module
+	top                    TopOptions                                     // Settings of the stats_top module
+	clientLimit            int                                            // Maximum number of clients exported per device by the endpoint_clients module
+	log                    *logger
 }
 
 // NewCollector initializes and returns a new Collector instance.
-func NewCollector(client *controld.Client, businessMode bool) *Collector {
-	return &Collector{
-		client:              client,
-		businessModeEnabled: businessMode,
+func NewCollector(client *controld.Client, opts Options) *Collector {
+	c := &Collector{
+		client:      client,
+		mode:        opts.Mode,
+		workers:     newWorkerPool(opts.MaxConcurrency),
+		top:         opts.Top.withTopDefaults(),
+		clientLimit: clientLimitOf(opts.ClientLimit),
+		snapshots:   map[string][]prometheus.Metric{},
+		statuses:    map[string]*moduleStatus{},
+	}
+
+	collectors := map[string]func(ctx context.Context, ch chan<- prometheus.Metric) error{
+		OrganizationModule:    c.collectOrganizationMetrics,
+		BillingModule:         c.collectBillingMetrics,
+		EndpointModule:        c.collectEndpointMetrics,
+		EndpointClientsModule: c.collectEndpointClientsMetrics,
+		NetworkModule:         c.collectNetworkMetrics,
+		ProfileModule:         c.collectProfileMetrics,
+		ServiceModule:         c.collectServiceMetrics,
+		StatsModule:           c.collectStatsMetrics,
+		StatsTopModule:        c.collectTopStatsMetrics,
 	}
+	for _, info := range Modules {
+		m := &module{name: info.Name, collect: collectors[info.Name], optIn: info.OptIn}
+		if !isModuleEnabled(opts.EnabledModules, m) {
+			continue
+		}
+		m.interval = refreshIntervalOf(opts.RefreshIntervals, m.name)
+		c.modules = append(c.modules, m)
+	}
+
+	// The organizations are shared by every module, so they must be as fresh as the module refreshed most often,
+	// even when the organization module, which refreshes them, is disabled.
+	c.organizations.ttl = c.shortestRefreshInterval()
+	c.subOrganizations.ttl = c.shortestRefreshInterval()
+
+	return c
 }
 
 // Describe sends the descriptions of all metrics to the Prometheus channel.
@@ -210,6 +579,14 @@ func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- controld_billing_subscription_amount_total
 	ch <- controld_billing_subscription_nextbill_timestamp
 	ch <- controld_endpoint_clients_total
+	ch <- controld_endpoint_status
+	ch <- controld_endpoint_last_activity_timestamp_seconds
+	ch <- controld_endpoint_ctrld_last_fetch_timestamp_seconds
+	ch <- controld_endpoint_info
+	ch <- controld_endpoint_ip_total
+	ch <- controld_endpoint_client_last_seen_timestamp_seconds
+	ch <- controld_endpoint_clients_by_os
+	ch <- controld_endpoint_profile_info
 	ch <- controld_network_health_code
 	ch <- controld_profile_content_filters_total
 	ch <- controld_profile_enabled_option_total
@@ -220,29 +597,68 @@ func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- controld_profile_services_total
 	ch <- controld_service_categories_total
 	ch <- controld_stats_last_queries_count
+	ch <- controld_dns_queries_total
+	ch <- controld_dns_queries_by_country_total
+	ch <- controld_dns_queries_by_protocol_total
+	ch <- controld_top_blocked_domains
+	ch <- controld_top_filters
+	ch <- controld_top_services
 	ch <- controld_organization_members_total
 	ch <- controld_organization_profiles_total
 	ch <- controld_organization_routers_total
 	ch <- controld_organization_sub_orgs_total
 	ch <- controld_organization_users_total
+	ch <- controld_organization_profiles_max
+	ch <- controld_organization_users_max
+	ch <- controld_organization_routers_max
+	ch <- controld_organization_sub_orgs_max
+	ch <- controld_organization_legacy_resolvers_max
+	ch <- controld_organization_user_price
+	ch <- controld_organization_router_price
+	ch <- controld_organization_info
+	ch <- controld_organization_twofa_required
+	ch <- controld_organization_siem_enabled
+	ch <- controld_organization_sso_enabled
+	ch <- controld_organization_trial_end_timestamp_seconds
 	ch <- controld_sub_organization_members_total
 	ch <- controld_sub_organization_profiles_total
 	ch <- controld_sub_organization_routers_total
 	ch <- controld_sub_organization_users_total
+	ch <- controld_sub_organization_profiles_max
+	ch <- controld_sub_organization_users_max
+	ch <- controld_sub_organization_routers_max
+	ch <- controld_sub_organization_legacy_resolvers_max
+	ch <- controld_sub_organization_user_price
+	ch <- controld_sub_organization_router_price
+	ch <- controld_sub_organization_info
+	ch <- controld_sub_organization_twofa_required
+	ch <- controld_sub_organization_siem_enabled
+	ch <- controld_sub_organization_allow_overrides
+	ch <- controld_exporter_scrape_success
+	ch <- controld_exporter_scrape_duration_seconds
+	ch <- controld_exporter_api_requests_total
+	ch <- controld_exporter_api_retries_total
 }
 
-// Collect gathers metrics from ControlD and sends them to the Prometheus channel.
+// Collect sends the last metrics gathered by the background refreshers to the Prometheus channel.
+// Use ForScrape to select modules and to bound the modules collected on scrape by the deadline of the scrape.
 func (c *Collector) Collect(ch chan<- prometheus.Metric) {
-	c.collectOrganizationMetrics(ch)
-	c.collectBillingMetrics(ch)
-	c.collectEndpointMetrics(ch)
-	c.collectNetworkMetrics(ch)
-	c.collectProfileMetrics(ch)
-	c.collectServiceMetrics(ch)
-	c.collectStatsMetrics(ch)
+	c.collect(context.Background(), ch, nil)
 }
 
-// isRunningInPersonalMode checks if the collector is running in personal mode.
-func (c *Collector) isRunningInPersonalMode() bool {
-	return !(c.businessModeEnabled)
+// isModuleEnabled checks if the module is enabled. Modules missing from the map are enabled unless they are opt-in.
+func isModuleEnabled(enabled map[string]bool, m *module) bool {
+	isEnabled, ok := enabled[m.name]
+	if !ok {
+		return !m.optIn
+	}
+	return isEnabled
+}
+
+// clientLimitOf returns the number of clients exported per device, or the default number when it is not positive.
+func clientLimitOf(limit int) int {
+	if limit <= 0 {
+		return DefaultClientLimit
+	}
+	return min(limit, MaxClientLimit)
 }
@@ -0,0 +1,151 @@
+package collector
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/umatare5/controld-exporter/internal/controld"
+)
+
+// fakeResponse is a response sent by the fake API.
+type fakeResponse struct {
+	status int
+	body   string
+}
+
+// okBody wraps the body of a successful response of the API.
+func okBody(body string) string {
+	return `{"success":true,"body":` + body + `}`
+}
+
+const (
+	emptyReportBody = `{"success":true,"body":{"queries":[]}}`
+	notFoundBody    = `{"success":false,"error":{"code":40400,"message":"not found"}}`
+)
+
+// fakeAPI is a server answering each request with the response of its path, for the organization given by the
+// X-Force-Org-Id header if any. The routes are keyed by path, or by organization ID and path such as "sub1 /devices".
+// The paths without a response are answered with a 404.
+type fakeAPI struct {
+	*httptest.Server
+	mu     sync.Mutex
+	routes map[string]fakeResponse
+}
+
+// newFakeAPI returns a fake API serving the routes.
+func newFakeAPI(t *testing.T, routes map[string]fakeResponse) *fakeAPI {
+	t.Helper()
+
+	api := &fakeAPI{routes: maps.Clone(routes)}
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := api.responseOf(r.Header.Get("X-Force-Org-Id"), r.URL.Path)
+		w.WriteHeader(resp.status)
+		_, _ = w.Write([]byte(resp.body))
+	}))
+	t.Cleanup(api.Close)
+
+	return api
+}
+
+// set replaces the response of the route.
+func (api *fakeAPI) set(route string, resp fakeResponse) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	api.routes[route] = resp
+}
+
+// responseOf returns the response of the path for the organization.
+func (api *fakeAPI) responseOf(orgID string, path string) fakeResponse {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	if resp, ok := api.routes[orgID+" "+path]; ok {
+		return resp
+	}
+	if resp, ok := api.routes[path]; ok {
+		return resp
+	}
+	return fakeResponse{status: http.StatusNotFound, body: notFoundBody}
+}
+
+// newTestCollector returns a collector sending its requests to the fake API without retry nor rate limit.
+func newTestCollector(server *fakeAPI, opts Options) *Collector {
+	client := controld.NewClient(
+		"key",
+		controld.WithBaseURL(server.URL),
+		controld.WithAnalyticsURL(server.URL),
+		controld.WithRetryPolicy(controld.RetryPolicy{MaxAttempts: 1}),
+		controld.WithRateLimit(controld.RateLimit{}),
+		controld.WithAnalyticsRateLimit(controld.RateLimit{}),
+	)
+	return NewCollector(client, opts)
+}
+
+// moduleOf returns the enabled module of the name.
+func moduleOf(t *testing.T, c *Collector, name string) *module {
+	t.Helper()
+
+	for _, m := range c.modules {
+		if m.name == name {
+			return m
+		}
+	}
+	t.Fatalf("module %s is not enabled", name)
+	return nil
+}
+
+// refreshModule runs a single refresh of the module.
+func refreshModule(t *testing.T, c *Collector, name string) {
+	t.Helper()
+
+	c.refresh(context.Background(), moduleOf(t, c, name))
+}
+
+// countMetrics counts the metrics of the snapshot of the module by description.
+func countMetrics(c *Collector, name string) map[*prometheus.Desc]int {
+	counts := map[*prometheus.Desc]int{}
+	for _, metric := range c.snapshotOf(name) {
+		counts[metric.Desc()]++
+	}
+	return counts
+}
+
+// scrapeSuccessOf returns the outcome of the last run of the module for the organization.
+func scrapeSuccessOf(c *Collector, name string, orgID string) (bool, bool) {
+	c.statusesMu.RLock()
+	defer c.statusesMu.RUnlock()
+
+	status, ok := c.statuses[name]
+	if !ok {
+		return false, false
+	}
+	success, ok := status.success[orgID]
+	return success, ok
+}
+
+// valuesByOrg returns the value of each metric of the description in the snapshot of the module by organization ID.
+// The values of the metrics of the same organization are added up.
+func valuesByOrg(t *testing.T, c *Collector, name string, desc *prometheus.Desc) map[string]float64 {
+	t.Helper()
+
+	values := map[string]float64{}
+	for _, metric := range c.snapshotOf(name) {
+		if metric.Desc() != desc {
+			continue
+		}
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		orgID, _ := orgIDOf(metric)
+		values[orgID] += m.GetGauge().GetValue() + m.GetCounter().GetValue()
+	}
+	return values
+}
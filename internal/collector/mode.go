@@ -0,0 +1,95 @@
+// Package collector contains Prometheus metric collectors for the exporter.
+package collector
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	modeLogPrefix         = "mode"
+	modeDetectionInterval = 10 * time.Minute // Interval to detect the mode again in auto mode
+	modeRetryInterval     = time.Minute      // Interval to retry the first detection of the mode after a failure
+)
+
+// Modes of the collector.
+const (
+	PersonalMode = "personal" // Collects the personal instance
+	BusinessMode = "business" // Collects the main organization and its sub-organizations
+	AutoMode     = "auto"     // Detects whether the API key belongs to a business organization
+)
+
+// Modes lists the modes of the collector.
+var Modes = []string{PersonalMode, BusinessMode, AutoMode}
+
+// isRunningInPersonalMode checks if the collector is running in personal mode.
+// In auto mode, the collector runs in personal mode until a business organization is detected.
+func (c *Collector) isRunningInPersonalMode() bool {
+	switch c.mode {
+	case BusinessMode:
+		return false
+	case AutoMode:
+		return !c.businessAccount.Load()
+	default:
+		return true
+	}
+}
+
+// awaitModeDetection detects the mode unless it has already been detected, e.g. by Validate, and retries on every tick
+// of the retry interval until it succeeds. It returns false when the context is canceled first.
+func (c *Collector) awaitModeDetection(ctx context.Context) bool {
+	ticker := time.NewTicker(modeRetryInterval)
+	defer ticker.Stop()
+
+	for !c.modeDetected.Load() && !c.detectMode(ctx) {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+	return true
+}
+
+// runModeDetector detects the mode again on every tick of the detection interval until the context is canceled.
+// The mode must have been detected once already.
+func (c *Collector) runModeDetector(ctx context.Context) {
+	c.logMode()
+
+	ticker := time.NewTicker(modeDetectionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			wasBusinessAccount := c.businessAccount.Load()
+			if c.detectMode(ctx) && wasBusinessAccount != c.businessAccount.Load() {
+				c.logMode()
+			}
+		}
+	}
+}
+
+// detectMode detects whether the API key belongs to a business organization.
+// The previous mode is kept when the detection fails. It returns whether the detection succeeded.
+func (c *Collector) detectMode(ctx context.Context) bool {
+	if _, err := c.detectBusinessAccount(ctx); err != nil {
+		c.log.warn(modeLogPrefix, warnModeDetectionFailed+"%v", err)
+		return false
+	}
+	return true
+}
+
+// logMode reports the detected mode.
+func (c *Collector) logMode() {
+	switch {
+	case !c.modeDetected.Load():
+		return
+	case c.businessAccount.Load():
+		c.log.info(modeLogPrefix, logDetectedBusinessMode)
+	default:
+		c.log.info(modeLogPrefix, logDetectedPersonalMode)
+	}
+}
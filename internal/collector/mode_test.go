@@ -0,0 +1,116 @@
+package collector
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/umatare5/controld-exporter/internal/controld"
+)
+
+// organizationBody is the main organization returned by the fake API.
+var organizationBody = okBody(`{"organization":{"PK":"org1","name":"Org","stats_endpoint":"america"}}`)
+
+func TestDetectMode(t *testing.T) {
+	tests := []struct {
+		name         string
+		response     fakeResponse
+		wantDetected bool
+		wantBusiness bool
+	}{
+		{
+			name:         "organization found",
+			response:     fakeResponse{status: http.StatusOK, body: organizationBody},
+			wantDetected: true,
+			wantBusiness: true,
+		},
+		{
+			name:         "forbidden",
+			response:     fakeResponse{status: http.StatusForbidden, body: notFoundBody},
+			wantDetected: true,
+		},
+		{
+			name:         "not found",
+			response:     fakeResponse{status: http.StatusNotFound, body: notFoundBody},
+			wantDetected: true,
+		},
+		{
+			name:         "failure reported with 200",
+			response:     fakeResponse{status: http.StatusOK, body: `{"success":false,"error":{"code":40000,"message":"no organization"}}`},
+			wantDetected: true,
+		},
+		{
+			name:         "server error keeps the previous mode",
+			response:     fakeResponse{status: http.StatusInternalServerError, body: notFoundBody},
+			wantBusiness: true,
+		},
+		{
+			name:         "rejected API key keeps the previous mode",
+			response:     fakeResponse{status: http.StatusUnauthorized, body: notFoundBody},
+			wantBusiness: true,
+		},
+		{
+			name:         "invalid response keeps the previous mode",
+			response:     fakeResponse{status: http.StatusOK, body: `{"success":true,`},
+			wantBusiness: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeAPI(t, map[string]fakeResponse{controld.OrganizationEndpoint: tt.response})
+			c := newTestCollector(server, Options{Mode: AutoMode})
+			c.businessAccount.Store(true) // Detected as business by a previous run
+
+			if got := c.detectMode(context.Background()); got != tt.wantDetected {
+				t.Errorf("detectMode() = %v, want %v", got, tt.wantDetected)
+			}
+			if got := c.businessAccount.Load(); got != tt.wantBusiness {
+				t.Errorf("businessAccount = %v, want %v", got, tt.wantBusiness)
+			}
+		})
+	}
+}
+
+func TestAwaitModeDetection(t *testing.T) {
+	t.Run("detected", func(t *testing.T) {
+		server := newFakeAPI(t, map[string]fakeResponse{controld.OrganizationEndpoint: {status: http.StatusOK, body: organizationBody}})
+		c := newTestCollector(server, Options{Mode: AutoMode})
+
+		if !c.awaitModeDetection(context.Background()) {
+			t.Fatal("awaitModeDetection() = false, want true")
+		}
+		if !c.modeDetected.Load() || c.isRunningInPersonalMode() {
+			t.Error("the collector runs in personal mode after detecting a business organization")
+		}
+	})
+
+	t.Run("canceled while the detection fails", func(t *testing.T) {
+		server := newFakeAPI(t, map[string]fakeResponse{controld.OrganizationEndpoint: {status: http.StatusInternalServerError, body: notFoundBody}})
+		c := newTestCollector(server, Options{Mode: AutoMode})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		if c.awaitModeDetection(ctx) {
+			t.Fatal("awaitModeDetection() = true, want false")
+		}
+		if c.modeDetected.Load() {
+			t.Error("modeDetected = true, want false")
+		}
+	})
+}
+
+func TestCollectOnScrapeAwaitsModeDetection(t *testing.T) {
+	server := newFakeAPI(t, map[string]fakeResponse{controld.DnsQueriesReportEndpoint: {status: http.StatusOK, body: emptyReportBody}})
+	c := newTestCollector(server, Options{Mode: AutoMode, RefreshIntervals: map[string]time.Duration{StatsModule: 0}})
+
+	ch := make(chan prometheus.Metric, 100)
+	c.collectOnScrape(context.Background(), ch, moduleOf(t, c, StatsModule))
+
+	if len(ch) != 0 {
+		t.Errorf("collectOnScrape() sent %d metrics before the mode was detected, want 0", len(ch))
+	}
+}
@@ -2,6 +2,7 @@
 package collector
 
 import (
+	"context"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -10,16 +11,17 @@ const (
 )
 
 // collectNetworkMetrics collects all network-related metrics.
-func (c *Collector) collectNetworkMetrics(ch chan<- prometheus.Metric) {
-	c.collectNetworkHealthStatus(ch)
+func (c *Collector) collectNetworkMetrics(ctx context.Context, ch chan<- prometheus.Metric) error {
+	return c.collectNetworkHealthStatus(ctx, ch)
 }
 
 // collectNetworkHealthStatus collects metrics for network nodes.
-func (c *Collector) collectNetworkHealthStatus(ch chan<- prometheus.Metric) {
-	network, err := c.client.GetNetwork()
+func (c *Collector) collectNetworkHealthStatus(ctx context.Context, ch chan<- prometheus.Metric) error {
+	network, err := c.client.GetNetwork(ctx)
+	recordScrape(ctx, dummyOrgId, err)
 	if err != nil {
 		c.log.error(networkHealthLogPrefix, errFetchingMetrics+"%v", err)
-		return
+		return err
 	}
 
 	for _, node := range network.Body.Network {
@@ -53,4 +55,6 @@ func (c *Collector) collectNetworkHealthStatus(ch chan<- prometheus.Metric) {
 			"proxy",
 		)
 	}
+
+	return nil
 }
@@ -2,6 +2,10 @@
 package collector
 
 import (
+	"context"
+	"strconv"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/umatare5/controld-exporter/internal/controld"
 )
@@ -12,26 +16,32 @@ const (
 )
 
 // collectOrganizationMetrics collects organization-related metrics.
-func (c *Collector) collectOrganizationMetrics(ch chan<- prometheus.Metric) {
+func (c *Collector) collectOrganizationMetrics(ctx context.Context, ch chan<- prometheus.Metric) error {
 	if c.isRunningInPersonalMode() {
-		c.log.debug(profileLogPrefix, logSkipOrgScraping)
-		return
+		c.log.debug(organizationLogPrefix, logSkipOrgScraping)
+		return nil
 	}
 
 	// organization metrics are only available in business mode.
-	org, err := c.fetchMainOrganization()
-	c.collectMainOrganizationMetrics(ch, org)
+	org, err := c.refreshMainOrganization(ctx)
 	if err != nil {
 		c.log.error(organizationLogPrefix, errFetchingMainOrgMetrics+"%v", err)
-		return
+		return err
 	}
+	recordScrape(ctx, org.Body.Organization.PK, nil)
+	c.collectMainOrganizationMetrics(ch, org)
+	c.collectMainOrganizationPostureMetrics(ch, org)
 
-	subOrgs, err := c.fetchSubOrganizations()
-	c.collectSubOrganizationMetrics(ch, subOrgs)
+	subOrgs, err := c.refreshSubOrganizations(ctx)
 	if err != nil {
+		recordSubOrgsFailure(ctx, err)
 		c.log.error(subOrganizationLogPrefix, errFetchingSubOrgMetrics+"%v", err)
-		return
+		return err
 	}
+	c.collectSubOrganizationMetrics(ch, subOrgs)
+	c.collectSubOrganizationPostureMetrics(ch, subOrgs)
+
+	return nil
 }
 
 // collectMainOrganizationMetrics collects metrics for main organization.
@@ -71,6 +81,55 @@ func (c *Collector) collectMainOrganizationMetrics(ch chan<- prometheus.Metric,
 		org.Body.Organization.Name,
 		org.Body.Organization.PK,
 	)
+	ch <- prometheus.MustNewConstMetric(
+		controld_organization_profiles_max,
+		prometheus.GaugeValue,
+		float64(org.Body.Organization.Profiles.Max),
+		org.Body.Organization.Name,
+		org.Body.Organization.PK,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		controld_organization_users_max,
+		prometheus.GaugeValue,
+		float64(org.Body.Organization.Users.Max),
+		org.Body.Organization.Name,
+		org.Body.Organization.PK,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		controld_organization_routers_max,
+		prometheus.GaugeValue,
+		float64(org.Body.Organization.Routers.Max),
+		org.Body.Organization.Name,
+		org.Body.Organization.PK,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		controld_organization_sub_orgs_max,
+		prometheus.GaugeValue,
+		float64(org.Body.Organization.SubOrganizations.Max),
+		org.Body.Organization.Name,
+		org.Body.Organization.PK,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		controld_organization_legacy_resolvers_max,
+		prometheus.GaugeValue,
+		float64(org.Body.Organization.MaxLegacyResolvers),
+		org.Body.Organization.Name,
+		org.Body.Organization.PK,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		controld_organization_user_price,
+		prometheus.GaugeValue,
+		float64(org.Body.Organization.Users.Price),
+		org.Body.Organization.Name,
+		org.Body.Organization.PK,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		controld_organization_router_price,
+		prometheus.GaugeValue,
+		float64(org.Body.Organization.Routers.Price),
+		org.Body.Organization.Name,
+		org.Body.Organization.PK,
+	)
 }
 
 // collectSubOrganizationMetrics collects metrics for sub organizations.
@@ -104,47 +163,177 @@ func (c *Collector) collectSubOrganizationMetrics(ch chan<- prometheus.Metric, s
 			subOrg.Name,
 			subOrg.PK,
 		)
+		ch <- prometheus.MustNewConstMetric(
+			controld_sub_organization_profiles_max,
+			prometheus.GaugeValue,
+			float64(subOrg.Profiles.Max),
+			subOrg.Name,
+			subOrg.PK,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			controld_sub_organization_users_max,
+			prometheus.GaugeValue,
+			float64(subOrg.Users.Max),
+			subOrg.Name,
+			subOrg.PK,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			controld_sub_organization_routers_max,
+			prometheus.GaugeValue,
+			float64(subOrg.Routers.Max),
+			subOrg.Name,
+			subOrg.PK,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			controld_sub_organization_legacy_resolvers_max,
+			prometheus.GaugeValue,
+			float64(subOrg.MaxLegacyResolvers),
+			subOrg.Name,
+			subOrg.PK,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			controld_sub_organization_user_price,
+			prometheus.GaugeValue,
+			float64(subOrg.Users.Price),
+			subOrg.Name,
+			subOrg.PK,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			controld_sub_organization_router_price,
+			prometheus.GaugeValue,
+			float64(subOrg.Routers.Price),
+			subOrg.Name,
+			subOrg.PK,
+		)
 	}
 }
 
-// fetchMainOrganization fetches and caches main organization data.
-func (c *Collector) fetchMainOrganization() (*controld.OrganizationResponse, error) {
-	c.organizationsMu.Lock()
-	defer c.organizationsMu.Unlock()
+// collectMainOrganizationPostureMetrics collects security posture metrics for main organization.
+// Secrets such as the Okta client secret are never exported.
+func (c *Collector) collectMainOrganizationPostureMetrics(ch chan<- prometheus.Metric, org *controld.OrganizationResponse) {
+	ch <- prometheus.MustNewConstMetric(
+		controld_organization_info,
+		prometheus.GaugeValue,
+		1,
+		org.Body.Organization.Name,
+		org.Body.Organization.StatusPrinted,
+		org.Body.Organization.BillingMethodPrinted,
+		org.Body.Organization.PK,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		controld_organization_twofa_required,
+		prometheus.GaugeValue,
+		boolToFloat64(org.Body.Organization.TwofaReq != 0),
+		org.Body.Organization.Name,
+		org.Body.Organization.PK,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		controld_organization_siem_enabled,
+		prometheus.GaugeValue,
+		boolToFloat64(org.Body.Organization.SiemEnabled != 0),
+		org.Body.Organization.Name,
+		org.Body.Organization.PK,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		controld_organization_sso_enabled,
+		prometheus.GaugeValue,
+		boolToFloat64(org.Body.Organization.SsoProvider != ""),
+		org.Body.Organization.Name,
+		org.Body.Organization.SsoProvider,
+		org.Body.Organization.PK,
+	)
 
-	// Return cached data if already fetched
-	if c.organizations != nil {
-		return c.organizations, nil
+	// The trial end is empty once the organization has left the trial.
+	if org.Body.Organization.TrialEnd == "" {
+		return
 	}
-
-	// Fetch organization data from the API
-	orgs, err := c.client.GetMainOrganization()
+	trialEnd, err := parseOrganizationTime(org.Body.Organization.TrialEnd)
 	if err != nil {
-		return nil, err
+		c.log.warn(organizationLogPrefix, warnInvalidTrialEnd+"%s: %v", org.Body.Organization.PK, err)
+		return
 	}
-
-	c.organizations = orgs
-	return orgs, nil
+	ch <- prometheus.MustNewConstMetric(
+		controld_organization_trial_end_timestamp_seconds,
+		prometheus.GaugeValue,
+		float64(trialEnd.Unix()),
+		org.Body.Organization.Name,
+		org.Body.Organization.PK,
+	)
 }
 
-// fetchSubrganizations fetches and caches sub organization data.
-func (c *Collector) fetchSubOrganizations() (*controld.SubOrganizationsResponse, error) {
-	c.subOrganizationsMu.Lock()
-	defer c.subOrganizationsMu.Unlock()
+// collectSubOrganizationPostureMetrics collects security posture metrics for sub organizations.
+func (c *Collector) collectSubOrganizationPostureMetrics(ch chan<- prometheus.Metric, subOrgs *controld.SubOrganizationsResponse) {
+	for _, subOrg := range subOrgs.Body.SubOrganizations {
+		ch <- prometheus.MustNewConstMetric(
+			controld_sub_organization_info,
+			prometheus.GaugeValue,
+			1,
+			subOrg.Name,
+			subOrg.StatusPrinted,
+			subOrg.BillingMethodPrinted,
+			subOrg.PK,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			controld_sub_organization_twofa_required,
+			prometheus.GaugeValue,
+			boolToFloat64(subOrg.TwofaReq != 0),
+			subOrg.Name,
+			subOrg.PK,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			controld_sub_organization_siem_enabled,
+			prometheus.GaugeValue,
+			boolToFloat64(subOrg.SiemEnabled != 0),
+			subOrg.Name,
+			subOrg.PK,
+		)
 
-	// Return cached data if already fetched
-	if c.subOrganizations != nil {
-		return c.subOrganizations, nil
+		// The API returns the flag as a string, e.g. "1".
+		allowOverrides, err := strconv.ParseBool(subOrg.AllowOverrides)
+		if err != nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			controld_sub_organization_allow_overrides,
+			prometheus.GaugeValue,
+			boolToFloat64(allowOverrides),
+			subOrg.Name,
+			subOrg.PK,
+		)
 	}
+}
 
-	// Fetch organization data from the API
-	orgs, err := c.client.GetSubOrganizations()
-	if err != nil {
-		return nil, err
+// parseOrganizationTime parses a date of an organization given in unix time, in RFC 3339 or as "2006-01-02 15:04:05" in UTC.
+func parseOrganizationTime(value string) (time.Time, error) {
+	if ts, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(ts, 0), nil
 	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateTime, value)
+}
+
+// fetchMainOrganization fetches and caches main organization data until it expires.
+// Concurrent callers share a single request to the API.
+func (c *Collector) fetchMainOrganization(ctx context.Context) (*controld.OrganizationResponse, error) {
+	return c.organizations.get(ctx, c.client.GetMainOrganization)
+}
+
+// fetchSubOrganizations fetches and caches sub organization data until it expires.
+// Concurrent callers share a single request to the API.
+func (c *Collector) fetchSubOrganizations(ctx context.Context) (*controld.SubOrganizationsResponse, error) {
+	return c.subOrganizations.get(ctx, c.client.GetSubOrganizations)
+}
+
+// refreshMainOrganization fetches main organization data and replaces the cached data on success.
+func (c *Collector) refreshMainOrganization(ctx context.Context) (*controld.OrganizationResponse, error) {
+	return c.organizations.refresh(ctx, c.client.GetMainOrganization)
+}
 
-	c.subOrganizations = orgs
-	return orgs, nil
+// refreshSubOrganizations fetches sub organization data and replaces the cached data on success.
+func (c *Collector) refreshSubOrganizations(ctx context.Context) (*controld.SubOrganizationsResponse, error) {
+	return c.subOrganizations.refresh(ctx, c.client.GetSubOrganizations)
 }
 
 // extractSubOrganizationIDs extracts sub-organization IDs from the response.
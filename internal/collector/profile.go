@@ -2,6 +2,9 @@
 package collector
 
 import (
+	"context"
+	"errors"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/umatare5/controld-exporter/internal/controld"
 )
@@ -11,61 +14,68 @@ const (
 )
 
 // collectProfileMetrics collects profile-related metrics.
-func (c *Collector) collectProfileMetrics(ch chan<- prometheus.Metric) {
+func (c *Collector) collectProfileMetrics(ctx context.Context, ch chan<- prometheus.Metric) error {
 	if c.isRunningInPersonalMode() {
-		c.collectPersonalProfileMetrics(ch)
 		c.log.debug(profileLogPrefix, logSkipOrgScraping)
-		return
+		return c.collectPersonalProfileMetrics(ctx, ch)
 	}
 
 	// Organization metrics are only available in business mode.
-	org, err := c.fetchMainOrganization()
+	org, err := c.fetchMainOrganization(ctx)
 	if err != nil {
 		c.log.info(profileLogPrefix, logNotFoundMainOrg)
-		return
+		return err
 	}
-	c.collectMainOrgProfileMetrics(ch, org)
+	mainErr := c.collectMainOrgProfileMetrics(ctx, ch, org)
 
-	subOrgs, err := c.fetchSubOrganizations()
+	subOrgs, err := c.fetchSubOrganizations(ctx)
 	if err != nil {
+		recordSubOrgsFailure(ctx, err)
 		c.log.info(profileLogPrefix, logNotFoundSubOrgs)
-		return
+		return errors.Join(mainErr, err)
 	}
-	c.collectSubOrgProfileMetrics(ch, subOrgs)
+	subErr := c.collectSubOrgProfileMetrics(ctx, ch, subOrgs)
+
+	return errors.Join(mainErr, subErr)
 }
 
 // collectPersonalProfileMetrics collects metrics for profiles in the personal instance.
-func (c *Collector) collectPersonalProfileMetrics(ch chan<- prometheus.Metric) {
-	profiles, err := c.client.GetProfiles()
+func (c *Collector) collectPersonalProfileMetrics(ctx context.Context, ch chan<- prometheus.Metric) error {
+	profiles, err := c.client.GetProfiles(ctx)
+	recordScrape(ctx, dummyOrgId, err)
 	if err != nil {
 		c.log.error(profileLogPrefix, errFetchingPersonalMetrics+"%v", err)
-		return
+		return err
 	}
 
 	c.storeProfileMetrics(ch, profiles, dummyOrgId)
+	return nil
 }
 
 // collectMainOrgProfileMetrics collects metrics for profiles in the main organization.
-func (c *Collector) collectMainOrgProfileMetrics(ch chan<- prometheus.Metric, org *controld.OrganizationResponse) {
-	profiles, err := c.client.GetProfiles()
+func (c *Collector) collectMainOrgProfileMetrics(ctx context.Context, ch chan<- prometheus.Metric, org *controld.OrganizationResponse) error {
+	profiles, err := c.client.GetProfiles(ctx)
+	recordScrape(ctx, org.Body.Organization.PK, err)
 	if err != nil {
 		c.log.error(profileLogPrefix, errFetchingMainOrgMetrics+"%v", err)
-		return
+		return err
 	}
 	c.storeProfileMetrics(ch, profiles, org.Body.Organization.PK)
+	return nil
 }
 
 // collectSubOrgProfileMetrics collects metrics for profiles in sub organizations.
-func (c *Collector) collectSubOrgProfileMetrics(ch chan<- prometheus.Metric, orgs *controld.SubOrganizationsResponse) {
-	subOrgIDs := extractSubOrganizationIDs(orgs)
-	for _, subOrgID := range subOrgIDs {
-		profiles, err := c.client.GetSubOrgProfiles(subOrgID)
+func (c *Collector) collectSubOrgProfileMetrics(ctx context.Context, ch chan<- prometheus.Metric, orgs *controld.SubOrganizationsResponse) error {
+	return c.forEachSubOrg(ctx, extractSubOrganizationIDs(orgs), func(subOrgID string) error {
+		profiles, err := c.client.GetSubOrgProfiles(ctx, subOrgID)
+		recordScrape(ctx, subOrgID, err)
 		if err != nil {
 			c.log.error(profileLogPrefix, errFetchingSubOrgMetrics+"%s: %v", subOrgID, err)
-			continue
+			return err
 		}
 		c.storeProfileMetrics(ch, profiles, subOrgID)
-	}
+		return nil
+	})
 }
 
 // storeProfileMetrics stores profile metrics in the Prometheus channel.
@@ -80,6 +90,7 @@ func (c *Collector) storeProfileMetrics(ch chan<- prometheus.Metric, profiles *c
 			controld_profile_preset_filters_total,
 			prometheus.GaugeValue,
 			float64(profile.Profile.Flt.Count),
+			profile.PK,
 			profile.Name,
 			orgID,
 		)
@@ -87,6 +98,7 @@ func (c *Collector) storeProfileMetrics(ch chan<- prometheus.Metric, profiles *c
 			controld_profile_content_filters_total,
 			prometheus.GaugeValue,
 			float64(profile.Profile.Cflt.Count),
+			profile.PK,
 			profile.Name,
 			orgID,
 		)
@@ -94,6 +106,7 @@ func (c *Collector) storeProfileMetrics(ch chan<- prometheus.Metric, profiles *c
 			controld_profile_ip_filters_total,
 			prometheus.GaugeValue,
 			float64(profile.Profile.Cflt.Count),
+			profile.PK,
 			profile.Name,
 			orgID,
 		)
@@ -101,6 +114,7 @@ func (c *Collector) storeProfileMetrics(ch chan<- prometheus.Metric, profiles *c
 			controld_profile_rules_total,
 			prometheus.GaugeValue,
 			float64(profile.Profile.Rule.Count),
+			profile.PK,
 			profile.Name,
 			orgID,
 		)
@@ -108,6 +122,7 @@ func (c *Collector) storeProfileMetrics(ch chan<- prometheus.Metric, profiles *c
 			controld_profile_services_total,
 			prometheus.GaugeValue,
 			float64(profile.Profile.Svc.Count),
+			profile.PK,
 			profile.Name,
 			orgID,
 		)
@@ -115,6 +130,7 @@ func (c *Collector) storeProfileMetrics(ch chan<- prometheus.Metric, profiles *c
 			controld_profile_groups_total,
 			prometheus.GaugeValue,
 			float64(profile.Profile.Grp.Count),
+			profile.PK,
 			profile.Name,
 			orgID,
 		)
@@ -122,6 +138,7 @@ func (c *Collector) storeProfileMetrics(ch chan<- prometheus.Metric, profiles *c
 			controld_profile_enabled_option_total,
 			prometheus.GaugeValue,
 			float64(profile.Profile.Opt.Count),
+			profile.PK,
 			profile.Name,
 			orgID,
 		)
@@ -0,0 +1,335 @@
+// Package collector contains Prometheus metric collectors for the exporter.
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	refresherLogPrefix     = "refresher"
+	defaultRefreshInterval = time.Minute // Polling interval used when none is configured for a module
+)
+
+// module is a unit of metrics collection which is refreshed on its own interval.
+type module struct {
+	name     string                                                       // Name of the module
+	interval time.Duration                                                // Interval between two refreshes, or zero to collect on every scrape
+	collect  func(ctx context.Context, ch chan<- prometheus.Metric) error // Gathers the metrics of the module from the API
+	optIn    bool                                                         // Whether the module is disabled unless enabled explicitly
+}
+
+// isCollectedOnScrape checks if the module calls the API on every scrape instead of polling in the background.
+func (m *module) isCollectedOnScrape() bool {
+	return m.interval == 0
+}
+
+// scrapeCollector binds the Collector to the context and the module selection of a single scrape.
+type scrapeCollector struct {
+	*Collector
+	ctx      context.Context // Context canceled when the scrape is abandoned or its deadline is exceeded
+	selected map[string]bool // Modules selected for the scrape, or nil to select every module
+}
+
+// Collect sends the metrics of the scrape to the Prometheus channel.
+func (s *scrapeCollector) Collect(ch chan<- prometheus.Metric) {
+	s.Collector.collect(s.ctx, ch, s.selected)
+}
+
+// ForScrape returns a collector bound to the context of a single scrape which only serves the given modules.
+// Every enabled module is served when no module is given.
+// The API calls of the modules collected on scrape are aborted when the context is done.
+func (c *Collector) ForScrape(ctx context.Context, modules ...string) (prometheus.Collector, error) {
+	selected, err := c.selectModules(modules)
+	if err != nil {
+		return nil, err
+	}
+	return &scrapeCollector{Collector: c, ctx: ctx, selected: selected}, nil
+}
+
+// selectModules validates the names of the modules and returns them as a set.
+func (c *Collector) selectModules(modules []string) (map[string]bool, error) {
+	if len(modules) == 0 {
+		return nil, nil
+	}
+
+	selected := map[string]bool{}
+	for _, name := range modules {
+		if !c.hasModule(name) {
+			return nil, fmt.Errorf("unknown or disabled collector module: %q", name)
+		}
+		selected[name] = true
+	}
+	return selected, nil
+}
+
+// hasModule checks if the module is enabled in the collector.
+func (c *Collector) hasModule(name string) bool {
+	for _, m := range c.modules {
+		if m.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isSelected checks if the module is part of the selection. A nil selection selects every module.
+func isSelected(selected map[string]bool, name string) bool {
+	return selected == nil || selected[name]
+}
+
+// Start launches a background refresher for each polled module. The refreshers stop when the context is canceled.
+// In auto mode, the refreshers wait for the first successful detection of the mode, so that a business organization
+// is never collected in personal mode.
+func (c *Collector) Start(ctx context.Context) {
+	if c.mode != AutoMode {
+		c.startRefreshers(ctx)
+		return
+	}
+
+	go func() {
+		if !c.awaitModeDetection(ctx) {
+			return
+		}
+		c.startRefreshers(ctx)
+		c.runModeDetector(ctx)
+	}()
+}
+
+// startRefreshers launches a background refresher for each polled module.
+func (c *Collector) startRefreshers(ctx context.Context) {
+	for _, m := range c.modules {
+		if m.isCollectedOnScrape() {
+			continue
+		}
+		go c.runRefresher(ctx, m)
+	}
+}
+
+// IsReady checks if a module has been collected successfully, which also proves that the API key works.
+// A collector without modules polled in the background is ready from the start, since it calls the API on scrape.
+func (c *Collector) IsReady() bool {
+	if c.collected.Load() {
+		return true
+	}
+	for _, m := range c.modules {
+		if !m.isCollectedOnScrape() && m.name != NetworkModule {
+			return false
+		}
+	}
+	return true
+}
+
+// runRefresher refreshes the module immediately and then on every tick of its interval.
+func (c *Collector) runRefresher(ctx context.Context, m *module) {
+	c.refresh(ctx, m)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.refresh(ctx, m)
+		}
+	}
+}
+
+// refresh gathers the metrics of the module and replaces its snapshot.
+// A refresh may not outlast the interval of the module. The previous snapshot is kept when it fails, and the previous
+// metrics of the organizations which failed are kept when it fails only for some of them.
+func (c *Collector) refresh(ctx context.Context, m *module) {
+	ctx, cancel := context.WithTimeout(ctx, m.interval)
+	defer cancel()
+
+	ctx, results := withScrapeResults(ctx)
+	start := time.Now()
+	metrics, err := gatherMetrics(ctx, m.collect)
+	c.storeModuleStatus(m.name, time.Since(start), results, err)
+
+	if err != nil && !results.anySucceeded() && isNotEntitled(err) {
+		c.log.info(refresherLogPrefix, logModuleNotEntitled+"%s: %v", m.name, err)
+		return
+	}
+	if err != nil && !results.anySucceeded() {
+		c.log.warn(refresherLogPrefix, warnKeepLastSnapshot+"%s: %v", m.name, err)
+		return
+	}
+	if err != nil {
+		c.log.warn(refresherLogPrefix, warnKeepFailedOrgs+"%s: %v", m.name, err)
+		metrics = c.mergeSnapshot(m.name, metrics, results)
+	}
+
+	c.snapshotsMu.Lock()
+	c.snapshots[m.name] = metrics
+	c.snapshotsMu.Unlock()
+	c.markCollected(m, results)
+
+	c.log.debug(refresherLogPrefix, logRefreshedSnapshot+"%s (%d metrics)", m.name, len(metrics))
+}
+
+// collect sends the snapshot of each selected polled module, the metrics of each selected module collected on scrape
+// and the metrics about the exporter itself. The modules collected on scrape run concurrently.
+func (c *Collector) collect(ctx context.Context, ch chan<- prometheus.Metric, selected map[string]bool) {
+	var wg sync.WaitGroup
+	for _, m := range c.modules {
+		if !isSelected(selected, m.name) {
+			continue
+		}
+		if m.isCollectedOnScrape() {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.collectOnScrape(ctx, ch, m)
+			}()
+			continue
+		}
+
+		for _, metric := range c.snapshotOf(m.name) {
+			ch <- metric
+		}
+	}
+	wg.Wait()
+
+	c.collectExporterMetrics(ch, selected)
+}
+
+// collectOnScrape calls the API for the module and sends its metrics to the Prometheus channel directly.
+func (c *Collector) collectOnScrape(ctx context.Context, ch chan<- prometheus.Metric, m *module) {
+	if c.mode == AutoMode && !c.modeDetected.Load() {
+		c.log.debug(refresherLogPrefix, logAwaitModeDetection+"%s", m.name)
+		return
+	}
+
+	ctx, results := withScrapeResults(ctx)
+	start := time.Now()
+	err := m.collect(ctx, ch)
+	c.storeModuleStatus(m.name, time.Since(start), results, err)
+
+	if err != nil {
+		c.log.warn(refresherLogPrefix, warnScrapeFailed+"%s: %v", m.name, err)
+		return
+	}
+	c.markCollected(m, results)
+}
+
+// markCollected records that the module has been collected successfully if an API call of the run succeeded.
+// Runs without API calls, such as skipped modules, and the public network status do not prove that the API key works.
+func (c *Collector) markCollected(m *module, results *scrapeResults) {
+	if m.name == NetworkModule {
+		return
+	}
+
+	results.mu.Lock()
+	defer results.mu.Unlock()
+
+	for _, success := range results.success {
+		if success {
+			c.collected.Store(true)
+			return
+		}
+	}
+}
+
+// mergeSnapshot replaces the metrics of the organizations which failed during a partly failed run with their metrics
+// of the previous snapshot. The previous metrics of the organizations which were not reached are kept as well when the
+// run is incomplete, while the ones of the organizations which are gone are dropped. Metrics without organization ID
+// are taken from the run.
+func (c *Collector) mergeSnapshot(name string, metrics []prometheus.Metric, results *scrapeResults) []prometheus.Metric {
+	results.mu.Lock()
+	defer results.mu.Unlock()
+
+	merged := []prometheus.Metric{}
+	collected := map[string]bool{}
+	for _, metric := range metrics {
+		orgID, ok := orgIDOf(metric)
+		if ok && results.failed(orgID) {
+			continue
+		}
+		collected[orgID] = true
+		merged = append(merged, metric)
+	}
+	for _, metric := range c.snapshotOf(name) {
+		orgID, ok := orgIDOf(metric)
+		if !ok {
+			continue
+		}
+		_, seen := results.success[orgID]
+		if results.failed(orgID) || (results.incomplete && !seen && !collected[orgID]) {
+			merged = append(merged, metric)
+		}
+	}
+	return merged
+}
+
+// orgIDOf returns the organization ID the metric is labeled with, if any.
+func orgIDOf(metric prometheus.Metric) (string, bool) {
+	var m dto.Metric
+	if err := metric.Write(&m); err != nil {
+		return "", false
+	}
+	for _, label := range m.GetLabel() {
+		if label.GetName() == "orgId" {
+			return label.GetValue(), true
+		}
+	}
+	return "", false
+}
+
+// snapshotOf returns the last good metrics gathered by the module.
+func (c *Collector) snapshotOf(name string) []prometheus.Metric {
+	c.snapshotsMu.RLock()
+	defer c.snapshotsMu.RUnlock()
+
+	return c.snapshots[name]
+}
+
+// gatherMetrics runs the collect function and buffers the metrics it sends.
+func gatherMetrics(ctx context.Context, collect func(ctx context.Context, ch chan<- prometheus.Metric) error) ([]prometheus.Metric, error) {
+	ch := make(chan prometheus.Metric)
+	done := make(chan []prometheus.Metric)
+
+	go func() {
+		metrics := []prometheus.Metric{}
+		for metric := range ch {
+			metrics = append(metrics, metric)
+		}
+		done <- metrics
+	}()
+
+	err := collect(ctx, ch)
+	close(ch)
+	metrics := <-done
+
+	return metrics, err
+}
+
+// shortestRefreshInterval returns the shortest polling interval of the modules, or the default one when every module
+// is collected on scrape.
+func (c *Collector) shortestRefreshInterval() time.Duration {
+	shortest := time.Duration(0)
+	for _, m := range c.modules {
+		if !m.isCollectedOnScrape() && (shortest == 0 || m.interval < shortest) {
+			shortest = m.interval
+		}
+	}
+	if shortest == 0 {
+		return defaultRefreshInterval
+	}
+	return shortest
+}
+
+// refreshIntervalOf returns the configured polling interval of the module, or the default one.
+func refreshIntervalOf(intervals map[string]time.Duration, name string) time.Duration {
+	if interval, ok := intervals[name]; ok && interval >= 0 {
+		return interval
+	}
+	return defaultRefreshInterval
+}
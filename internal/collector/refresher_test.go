@@ -0,0 +1,160 @@
+package collector
+
+import (
+	"maps"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/umatare5/controld-exporter/internal/controld"
+)
+
+// subOrganizationsBody lists the sub-organizations sub1 and sub2.
+var subOrganizationsBody = okBody(`{"sub_organizations":[{"PK":"sub1","name":"Sub 1"},{"PK":"sub2","name":"Sub 2"}]}`)
+
+// categoriesBody returns service categories counting the services.
+func categoriesBody(count int) string {
+	return okBody(`{"categories":[{"PK":"ads","name":"Ads","count":` + strconv.Itoa(count) + `}]}`)
+}
+
+// newBusinessCollector returns a collector of the business organization org1 refreshing the service module.
+// The organizations are fetched again on every refresh.
+func newBusinessCollector(api *fakeAPI) *Collector {
+	c := newTestCollector(api, Options{
+		Mode:             BusinessMode,
+		RefreshIntervals: map[string]time.Duration{ServiceModule: time.Minute},
+	})
+	c.organizations.ttl = time.Nanosecond
+	c.subOrganizations.ttl = time.Nanosecond
+	return c
+}
+
+func TestModules(t *testing.T) {
+	enabled := map[string]bool{}
+	for _, info := range Modules {
+		enabled[info.Name] = true
+	}
+	c := NewCollector(controld.NewClient("key"), Options{EnabledModules: enabled})
+
+	if len(c.modules) != len(Modules) {
+		t.Fatalf("modules = %d, want %d", len(c.modules), len(Modules))
+	}
+	for i, m := range c.modules {
+		if m.name != Modules[i].Name || m.optIn != Modules[i].OptIn || m.collect == nil {
+			t.Errorf("module %d = (%s, optIn %v, collect %v), want (%s, optIn %v) with a collect function",
+				i, m.name, m.optIn, m.collect != nil, Modules[i].Name, Modules[i].OptIn)
+		}
+		if Modules[i].RefreshInterval <= 0 {
+			t.Errorf("module %s has no default refresh interval", m.name)
+		}
+	}
+}
+
+func TestRefreshWithFailingSubOrganizationList(t *testing.T) {
+	api := newFakeAPI(t, map[string]fakeResponse{
+		controld.OrganizationEndpoint:      {status: http.StatusOK, body: organizationBody},
+		controld.SubOrganizationsEndpoint:  {status: http.StatusOK, body: subOrganizationsBody},
+		controld.ServiceCategoriesEndpoint: {status: http.StatusOK, body: categoriesBody(1)},
+	})
+	c := newBusinessCollector(api)
+	refreshModule(t, c, ServiceModule)
+
+	api.set(controld.SubOrganizationsEndpoint, fakeResponse{status: http.StatusInternalServerError, body: notFoundBody})
+	api.set(controld.ServiceCategoriesEndpoint, fakeResponse{status: http.StatusOK, body: categoriesBody(2)})
+	refreshModule(t, c, ServiceModule)
+
+	want := map[string]float64{"org1": 2, "sub1": 1, "sub2": 1}
+	if got := valuesByOrg(t, c, ServiceModule, controld_service_categories_total); !maps.Equal(got, want) {
+		t.Errorf("controld_service_categories_total = %v, want the fresh main organization and the previous sub-organizations %v", got, want)
+	}
+	if success, _ := scrapeSuccessOf(c, ServiceModule, "org1"); !success {
+		t.Error("scrape success of org1 = false, want the main organization not to be blamed for the sub-organization list")
+	}
+	if success, ok := scrapeSuccessOf(c, ServiceModule, dummyOrgId); !ok || success {
+		t.Errorf("scrape success of %s = (%v, %v), want the failure of the sub-organization list", dummyOrgId, success, ok)
+	}
+}
+
+// orgMetric returns a service category metric of the organization.
+func orgMetric(orgID string, value float64) prometheus.Metric {
+	return prometheus.MustNewConstMetric(controld_service_categories_total, prometheus.GaugeValue, value, "Ads", orgID)
+}
+
+func TestMergeSnapshot(t *testing.T) {
+	tests := []struct {
+		name       string
+		previous   []prometheus.Metric
+		metrics    []prometheus.Metric
+		success    map[string]bool
+		incomplete bool
+		want       map[string]float64
+	}{
+		{
+			name:     "successful run replaces every organization",
+			previous: []prometheus.Metric{orgMetric("org1", 1), orgMetric("sub1", 1)},
+			metrics:  []prometheus.Metric{orgMetric("org1", 2), orgMetric("sub1", 2)},
+			success:  map[string]bool{"org1": true, "sub1": true},
+			want:     map[string]float64{"org1": 2, "sub1": 2},
+		},
+		{
+			name:     "failed organization keeps its previous series",
+			previous: []prometheus.Metric{orgMetric("org1", 1), orgMetric("sub1", 1)},
+			metrics:  []prometheus.Metric{orgMetric("org1", 2), orgMetric("sub1", 5)},
+			success:  map[string]bool{"org1": true, "sub1": false},
+			want:     map[string]float64{"org1": 2, "sub1": 1},
+		},
+		{
+			name:    "failed organization without previous series",
+			metrics: []prometheus.Metric{orgMetric("org1", 2), orgMetric("sub1", 5)},
+			success: map[string]bool{"org1": true, "sub1": false},
+			want:    map[string]float64{"org1": 2},
+		},
+		{
+			name:     "removed organization drops its series",
+			previous: []prometheus.Metric{orgMetric("org1", 1), orgMetric("sub1", 1), orgMetric("sub2", 1)},
+			metrics:  []prometheus.Metric{orgMetric("org1", 2), orgMetric("sub1", 2)},
+			success:  map[string]bool{"org1": true, "sub1": true},
+			want:     map[string]float64{"org1": 2, "sub1": 2},
+		},
+		{
+			name:       "incomplete run keeps the organizations not reached",
+			previous:   []prometheus.Metric{orgMetric("org1", 1), orgMetric("sub1", 1), orgMetric("sub2", 1)},
+			metrics:    []prometheus.Metric{orgMetric("org1", 2), orgMetric("sub1", 2)},
+			success:    map[string]bool{"org1": true, "sub1": true, dummyOrgId: false},
+			incomplete: true,
+			want:       map[string]float64{"org1": 2, "sub1": 2, "sub2": 1},
+		},
+		{
+			name:     "organization without series in the run",
+			previous: []prometheus.Metric{orgMetric("org1", 1), orgMetric("sub1", 1)},
+			metrics:  []prometheus.Metric{orgMetric("org1", 2)},
+			success:  map[string]bool{"org1": true, "sub1": true},
+			want:     map[string]float64{"org1": 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Collector{snapshots: map[string][]prometheus.Metric{ServiceModule: tt.previous}}
+			results := &scrapeResults{success: tt.success, incomplete: tt.incomplete}
+
+			merged := c.mergeSnapshot(ServiceModule, tt.metrics, results)
+
+			got := map[string]float64{}
+			for _, metric := range merged {
+				var m dto.Metric
+				if err := metric.Write(&m); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+				orgID, _ := orgIDOf(metric)
+				got[orgID] += m.GetGauge().GetValue()
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("mergeSnapshot() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
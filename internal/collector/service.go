@@ -2,6 +2,9 @@
 package collector
 
 import (
+	"context"
+	"errors"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/umatare5/controld-exporter/internal/controld"
 )
@@ -11,62 +14,69 @@ const (
 )
 
 // collectServiceMetrics collects service-related metrics.
-func (c *Collector) collectServiceMetrics(ch chan<- prometheus.Metric) {
+func (c *Collector) collectServiceMetrics(ctx context.Context, ch chan<- prometheus.Metric) error {
 	if c.isRunningInPersonalMode() {
-		c.collectPersonalServicesCategoryMetrics(ch)
 		c.log.debug(serviceLogPrefix, logSkipOrgScraping)
-		return
+		return c.collectPersonalServicesCategoryMetrics(ctx, ch)
 	}
 
 	// Organization metrics are only available in business mode.
-	org, err := c.fetchMainOrganization()
+	org, err := c.fetchMainOrganization(ctx)
 	if err != nil {
 		c.log.info(serviceLogPrefix, logNotFoundMainOrg)
-		return
+		return err
 	}
-	c.collectMainOrgServicesCategoryMetrics(ch, org)
+	mainErr := c.collectMainOrgServicesCategoryMetrics(ctx, ch, org)
 
-	subOrgs, err := c.fetchSubOrganizations()
+	subOrgs, err := c.fetchSubOrganizations(ctx)
 	if err != nil {
+		recordSubOrgsFailure(ctx, err)
 		c.log.info(serviceLogPrefix, logNotFoundSubOrgs)
-		return
+		return errors.Join(mainErr, err)
 	}
-	c.collectSubOrgServicesCategoryMetrics(ch, subOrgs)
+	subErr := c.collectSubOrgServicesCategoryMetrics(ctx, ch, subOrgs)
+
+	return errors.Join(mainErr, subErr)
 }
 
 // collectPersonalServicesCategoryMetrics collects metrics for ServiceCategories in the personal instance.
-func (c *Collector) collectPersonalServicesCategoryMetrics(ch chan<- prometheus.Metric) {
-	ServiceCategories, err := c.client.GetServiceCategories()
+func (c *Collector) collectPersonalServicesCategoryMetrics(ctx context.Context, ch chan<- prometheus.Metric) error {
+	ServiceCategories, err := c.client.GetServiceCategories(ctx)
+	recordScrape(ctx, dummyOrgId, err)
 	if err != nil {
 		c.log.error(serviceLogPrefix, errFetchingPersonalMetrics+"%v", err)
-		return
+		return err
 	}
 
 	c.storeServicesCategoryMetrics(ch, ServiceCategories, dummyOrgId)
+	return nil
 }
 
 // collectMainOrgServicesCategoryMetrics collects metrics for ServiceCategories in the main organization.
-func (c *Collector) collectMainOrgServicesCategoryMetrics(ch chan<- prometheus.Metric, org *controld.OrganizationResponse) {
-	ServiceCategories, err := c.client.GetServiceCategories()
+func (c *Collector) collectMainOrgServicesCategoryMetrics(ctx context.Context, ch chan<- prometheus.Metric, org *controld.OrganizationResponse) error {
+	ServiceCategories, err := c.client.GetServiceCategories(ctx)
+	recordScrape(ctx, org.Body.Organization.PK, err)
 	if err != nil {
 		c.log.error(serviceLogPrefix, errFetchingMainOrgMetrics+"%v", err)
-		return
+		return err
 	}
 
 	c.storeServicesCategoryMetrics(ch, ServiceCategories, org.Body.Organization.PK)
+	return nil
 }
 
 // collectSubOrgServicesCategoryMetrics collects metrics for ServiceCategories in sub organizations.
-func (c *Collector) collectSubOrgServicesCategoryMetrics(ch chan<- prometheus.Metric, subOrgs *controld.SubOrganizationsResponse) {
-	subOrgIDs := extractSubOrganizationIDs(subOrgs)
-	for _, subOrgID := range subOrgIDs {
-		ServiceCategories, err := c.client.GetSubOrgServiceCategories(subOrgID)
+func (c *Collector) collectSubOrgServicesCategoryMetrics(ctx context.Context, ch chan<- prometheus.Metric, subOrgs *controld.SubOrganizationsResponse) error {
+	return c.forEachSubOrg(ctx, extractSubOrganizationIDs(subOrgs), func(subOrgID string) error {
+		ServiceCategories, err := c.client.GetSubOrgServiceCategories(ctx, subOrgID)
+		recordScrape(ctx, subOrgID, err)
 		if err != nil {
 			c.log.error(serviceLogPrefix, errFetchingSubOrgMetrics+"%s: %v", subOrgID, err)
-			continue
+			return err
 		}
 		c.storeServicesCategoryMetrics(ch, ServiceCategories, subOrgID)
-	}
+		return nil
+	})
 }
 
 // storeServicesCategoryMetrics stores ServicesCategory metrics in the Prometheus channel.
@@ -2,92 +2,347 @@
 package collector
 
 import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/umatare5/controld-exporter/internal/controld"
-	"github.com/umatare5/controld-exporter/internal/log"
 )
 
 const (
-	statsLogPrefix = "stats"
+	statsLogPrefix   = "stats"
+	statsGranularity = time.Minute    // Width of a bucket of the DNS queries report
+	statsSettleDelay = time.Minute    // Time for the queries of a bucket to be reported after the bucket ends
+	statsMaxBackfill = 24 * time.Hour // Maximum age of the buckets backfilled after a gap
 )
 
+// queryBreakdown is a breakdown of DNS queries counted by the stats module.
+type queryBreakdown struct {
+	endpoint  string                  // Report endpoint of the breakdown
+	desc      *prometheus.Desc        // Description of the metric of the breakdown
+	normalize func(key string) string // Converts the key of the report to the label value
+}
+
+// queryBreakdowns lists the breakdowns of DNS queries counted by the stats module.
+var queryBreakdowns = []queryBreakdown{
+	{endpoint: controld.DnsQueriesByCountryEndpoint, desc: controld_dns_queries_by_country_total, normalize: strings.ToUpper},
+	{endpoint: controld.DnsQueriesByProtocolEndpoint, desc: controld_dns_queries_by_protocol_total, normalize: strings.ToLower},
+}
+
+// breakdownFetcher fetches a breakdown of DNS queries of an organization.
+type breakdownFetcher func(endpoint string, start, end time.Time) (*controld.CountsReportResponse, error)
+
+// queryVerdicts lists the verdicts which are exported even before a query is counted.
+var queryVerdicts = []string{"blocked", "bypassed", "redirected"}
+
+// queryCounters accumulates the DNS queries of the closed buckets of each organization or breakdown.
+type queryCounters struct {
+	mu       sync.Mutex               // Mutex to protect access to the counters
+	counters map[string]*queryCounter // Counters keyed by organization ID, or by breakdown endpoint and organization ID
+}
+
+// queryCounter holds the DNS queries counted for an organization or a breakdown.
+type queryCounter struct {
+	lastBucket time.Time          // Start of the last closed bucket counted
+	last       map[string]float64 // Number of queries of the last closed bucket, keyed by verdict
+	totals     map[string]float64 // Number of queries of all buckets counted, keyed by verdict
+}
+
 // collectStatsMetrics collects DNS query statistics metrics.
-func (c *Collector) collectStatsMetrics(ch chan<- prometheus.Metric) {
+func (c *Collector) collectStatsMetrics(ctx context.Context, ch chan<- prometheus.Metric) error {
 	if c.isRunningInPersonalMode() {
-		c.collectPersonalQueryStatsMetrics(ch)
 		c.log.debug(statsLogPrefix, logSkipOrgScraping)
-		return
+		return c.collectPersonalQueryStatsMetrics(ctx, ch)
 	}
 
 	// Organization metrics are only available in business mode.
-	org, err := c.fetchMainOrganization()
+	org, err := c.fetchMainOrganization(ctx)
 	if err != nil {
 		c.log.info(statsLogPrefix, logNotFoundMainOrg)
-		return
+		return err
 	}
-	c.collectMainOrgQueryStatsMetrics(ch, org, org.Body.Organization.StatsEndpoint)
+	mainErr := c.collectMainOrgQueryStatsMetrics(ctx, ch, org, org.Body.Organization.StatsEndpoint)
 
-	subOrgs, err := c.fetchSubOrganizations()
+	subOrgs, err := c.fetchSubOrganizations(ctx)
 	if err != nil {
+		recordSubOrgsFailure(ctx, err)
 		c.log.info(statsLogPrefix, logNotFoundSubOrgs)
-		return
+		return errors.Join(mainErr, err)
 	}
-	c.collectSubOrgQueryStatsMetrics(ch, subOrgs, org.Body.Organization.StatsEndpoint)
+	subErr := c.collectSubOrgQueryStatsMetrics(ctx, ch, subOrgs, org.Body.Organization.StatsEndpoint)
+
+	return errors.Join(mainErr, subErr)
 }
 
 // collectPersonalQueryStatsMetrics collects DNS query statistics for the personal instance.
-func (c *Collector) collectPersonalQueryStatsMetrics(ch chan<- prometheus.Metric) {
-	stats, err := c.client.GetDnsQueriesReport("america")
-	if err != nil {
-		log.Errorf("Error fetching stats for Business: %v", err)
-		return
+func (c *Collector) collectPersonalQueryStatsMetrics(ctx context.Context, ch chan<- prometheus.Metric) error {
+	start, end, ok := c.orgQueryCounters.pendingRange(dummyOrgId, time.Now())
+	if ok {
+		stats, err := c.client.GetDnsQueriesReport(ctx, personalStatsEndpoint, start, end)
+		recordScrape(ctx, dummyOrgId, err)
+		if err != nil {
+			c.log.error(statsLogPrefix, errFetchingPersonalMetrics+"%v", err)
+			return err
+		}
+		c.countQueries(&c.orgQueryCounters, stats, dummyOrgId, start, end)
 	}
+	c.storeStatsMetrics(ch, dummyOrgId)
+
+	c.countQueryBreakdowns(ch, dummyOrgId, errFetchingPersonalMetrics, func(endpoint string, start, end time.Time) (*controld.CountsReportResponse, error) {
+		return c.client.GetBreakdownReport(ctx, personalStatsEndpoint, endpoint, start, end)
+	})
 
-	c.storeStatsMetrics(ch, stats, dummyOrgId)
+	return nil
 }
 
 // collectMainOrgQueryStatsMetrics collects DNS query statistics for the main organization.
-func (c *Collector) collectMainOrgQueryStatsMetrics(ch chan<- prometheus.Metric, org *controld.OrganizationResponse, statsEndpoint string) {
-	stats, err := c.client.GetDnsQueriesReport(statsEndpoint)
-	if err != nil {
-		c.log.error(statsLogPrefix, errFetchingMainOrgMetrics+"%v", err)
-		return
+func (c *Collector) collectMainOrgQueryStatsMetrics(ctx context.Context, ch chan<- prometheus.Metric, org *controld.OrganizationResponse, statsEndpoint string) error {
+	orgID := org.Body.Organization.PK
+	start, end, ok := c.orgQueryCounters.pendingRange(orgID, time.Now())
+	if ok {
+		stats, err := c.client.GetDnsQueriesReport(ctx, statsEndpoint, start, end)
+		recordScrape(ctx, orgID, err)
+		if err != nil {
+			c.log.error(statsLogPrefix, errFetchingMainOrgMetrics+"%v", err)
+			return err
+		}
+		c.countQueries(&c.orgQueryCounters, stats, orgID, start, end)
 	}
+	c.storeStatsMetrics(ch, orgID)
+
+	c.countQueryBreakdowns(ch, orgID, errFetchingMainOrgMetrics, func(endpoint string, start, end time.Time) (*controld.CountsReportResponse, error) {
+		return c.client.GetBreakdownReport(ctx, statsEndpoint, endpoint, start, end)
+	})
 
-	c.storeStatsMetrics(ch, stats, org.Body.Organization.PK)
+	return nil
 }
 
 // collectSubOrgQueryStatsMetrics collects DNS query statistics for sub organizations.
-func (c *Collector) collectSubOrgQueryStatsMetrics(ch chan<- prometheus.Metric, subOrgs *controld.SubOrganizationsResponse, statsEndpoint string) {
-	subOrgIDs := extractSubOrganizationIDs(subOrgs)
-	for _, subOrgID := range subOrgIDs {
-		stats, err := c.client.GetSubOrgDnsQueriesReport(statsEndpoint, subOrgID)
+func (c *Collector) collectSubOrgQueryStatsMetrics(ctx context.Context, ch chan<- prometheus.Metric, subOrgs *controld.SubOrganizationsResponse, statsEndpoint string) error {
+	return c.forEachSubOrg(ctx, extractSubOrganizationIDs(subOrgs), func(subOrgID string) error {
+		start, end, ok := c.orgQueryCounters.pendingRange(subOrgID, time.Now())
+		if ok {
+			stats, err := c.client.GetSubOrgDnsQueriesReport(ctx, statsEndpoint, subOrgID, start, end)
+			recordScrape(ctx, subOrgID, err)
+			if err != nil {
+				c.log.error(statsLogPrefix, errFetchingSubOrgMetrics+"%s: %v", subOrgID, err)
+				return err
+			}
+			c.countQueries(&c.orgQueryCounters, stats, subOrgID, start, end)
+		}
+		c.storeStatsMetrics(ch, subOrgID)
+
+		c.countQueryBreakdowns(ch, subOrgID, errFetchingSubOrgMetrics+subOrgID+": ", func(endpoint string, start, end time.Time) (*controld.CountsReportResponse, error) {
+			return c.client.GetSubOrgBreakdownReport(ctx, statsEndpoint, subOrgID, endpoint, start, end)
+		})
+
+		return nil
+	})
+}
+
+// countQueryBreakdowns fetches the DNS queries of each breakdown of the organization which have not been counted yet,
+// and stores the counters in the Prometheus channel. The breakdowns which are not included in the plan are skipped.
+// The other errors are only logged: they are neither returned nor recorded in the scrape status, so that a failing
+// breakdown does not fail the module. Its counters are exported as of the last success.
+func (c *Collector) countQueryBreakdowns(ch chan<- prometheus.Metric, orgID string, errPrefix string, fetch breakdownFetcher) {
+	for _, breakdown := range queryBreakdowns {
+		key := breakdown.endpoint + "/" + orgID
+
+		start, end, ok := c.breakdownQueryCounters.pendingRange(key, time.Now())
+		if ok {
+			report, err := fetch(breakdown.endpoint, start, end)
+			if err != nil && isNotEntitled(err) {
+				c.log.debug(statsLogPrefix, logModuleNotEntitled+"%s: %v", breakdown.endpoint, err)
+				continue
+			}
+			if err != nil {
+				c.log.error(statsLogPrefix, errPrefix+"%v", err)
+			} else {
+				c.breakdownQueryCounters.add(key, countsByKey(report, breakdown.normalize), start, end)
+			}
+		}
+
+		totals, _, ok := c.breakdownQueryCounters.valuesOf(key)
+		if !ok {
+			continue
+		}
+		for label, total := range totals {
+			ch <- prometheus.MustNewConstMetric(
+				breakdown.desc,
+				prometheus.CounterValue,
+				total,
+				label,
+				orgID,
+			)
+		}
+	}
+}
+
+// countsByKey adds up the DNS queries of the report by normalized key.
+func countsByKey(report *controld.CountsReportResponse, normalize func(string) string) map[string]float64 {
+	counts := map[string]float64{}
+	for _, entry := range report.Body.Queries {
+		counts[normalize(entry.Key)] += float64(entry.Count)
+	}
+	return counts
+}
+
+// pendingRange returns the range of the closed buckets of the key which have not been counted yet.
+// It returns false when no bucket has closed since the last one counted.
+func (q *queryCounters) pendingRange(key string, now time.Time) (time.Time, time.Time, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// A bucket is closed once it ended and its queries had time to be reported.
+	end := now.Add(-statsSettleDelay).Truncate(statsGranularity)
+	start := end.Add(-statsGranularity) // Only the last closed bucket is counted on the first run
+	if counter, ok := q.counters[key]; ok {
+		start = counter.lastBucket.Add(statsGranularity)
+	}
+	start = maxTime(start, end.Add(-statsMaxBackfill))
+
+	return start, end, start.Before(end)
+}
+
+// countQueries adds the queries of the buckets between start and end which have not been counted yet to the counter of the key.
+// Every bucket of the range is counted afterwards, as the report omits the buckets without queries.
+func (c *Collector) countQueries(q *queryCounters, stats *controld.QueryStatsResponse, key string, start, end time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.counters == nil {
+		q.counters = map[string]*queryCounter{}
+	}
+	counter, ok := q.counters[key]
+	if !ok {
+		counter = &queryCounter{totals: map[string]float64{}}
+		for _, verdict := range queryVerdicts {
+			counter.totals[verdict] = 0
+		}
+		q.counters[key] = counter
+	} else if gap := start.Sub(counter.lastBucket.Add(statsGranularity)); gap > 0 {
+		c.log.warn(statsLogPrefix, warnSkipStatsBuckets+"%s: %s", key, gap)
+	}
+
+	buckets := []controld.QueryStatsBucket{}
+	if !isQueryStatsEmpty(stats) {
+		buckets = stats.Body.Queries
+	}
+	slices.SortFunc(buckets, compareBucketTimes)
+
+	lastBucket := end.Add(-statsGranularity)
+	last := map[string]float64{}
+	for _, verdict := range queryVerdicts {
+		last[verdict] = 0
+	}
+	for _, bucket := range buckets {
+		ts, err := bucket.Time()
 		if err != nil {
-			c.log.error(statsLogPrefix, errFetchingSubOrgMetrics+"%s: %v", subOrgID, err)
+			c.log.warn(statsLogPrefix, warnInvalidStatsBucket+"%q: %v", bucket.Ts, err)
+			continue
+		}
+		// Skip the buckets counted by a concurrent run and the buckets which are not closed yet.
+		if ts.Before(start) || !ts.Before(end) || (ok && !ts.After(counter.lastBucket)) {
 			continue
 		}
-		c.storeStatsMetrics(ch, stats, subOrgID)
+
+		for queryType, count := range bucket.Count {
+			verdict := mapQueryTypeToLabel(queryType)
+			counter.totals[verdict] += float64(count)
+			if ts.Equal(lastBucket) {
+				last[verdict] += float64(count)
+			}
+		}
+	}
+
+	if lastBucket.After(counter.lastBucket) {
+		counter.lastBucket = lastBucket
+		counter.last = last
 	}
 }
 
 // storeStatsMetrics stores DNS query statistics metrics in the Prometheus channel.
-func (c *Collector) storeStatsMetrics(ch chan<- prometheus.Metric, stats *controld.QueryStatsResponse, orgID string) {
-	if isQueryStatsEmpty(stats) {
-		c.log.warn(statsLogPrefix, warnSkipEmptyData+"%v", stats)
+func (c *Collector) storeStatsMetrics(ch chan<- prometheus.Metric, orgID string) {
+	totals, last, ok := c.orgQueryCounters.valuesOf(orgID)
+	if !ok {
 		return
 	}
 
-	query := stats.Body.Queries[0]
-	for queryType, count := range query.Count {
-		queryTypeLabel := mapQueryTypeToLabel(queryType)
+	for verdict, total := range totals {
 		ch <- prometheus.MustNewConstMetric(
-			controld_stats_last_queries_count,
+			controld_dns_queries_total,
 			prometheus.CounterValue,
-			float64(count),
-			queryTypeLabel,
+			total,
+			verdict,
 			orgID,
 		)
 	}
+
+	for verdict, count := range last {
+		ch <- prometheus.MustNewConstMetric(
+			controld_stats_last_queries_count,
+			prometheus.GaugeValue,
+			count,
+			verdict,
+			orgID,
+		)
+	}
+}
+
+// add adds the counts of the range to the counter of the key, unless a concurrent run has counted the range already.
+func (q *queryCounters) add(key string, counts map[string]float64, start, end time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.counters == nil {
+		q.counters = map[string]*queryCounter{}
+	}
+	counter, ok := q.counters[key]
+	if !ok {
+		counter = &queryCounter{totals: map[string]float64{}}
+		q.counters[key] = counter
+	}
+	if ok && !counter.lastBucket.Before(start) {
+		return
+	}
+
+	for label, count := range counts {
+		counter.totals[label] += count
+	}
+	counter.lastBucket = end.Add(-statsGranularity)
+}
+
+// valuesOf returns copies of the total and the last closed bucket of the counter of the key.
+// It returns false when nothing has been counted for the key yet.
+func (q *queryCounters) valuesOf(key string) (map[string]float64, map[string]float64, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	counter, ok := q.counters[key]
+	if !ok {
+		return nil, nil, false
+	}
+	return maps.Clone(counter.totals), maps.Clone(counter.last), true
+}
+
+// compareBucketTimes orders the buckets by their start. Buckets with an invalid start come first.
+func compareBucketTimes(a, b controld.QueryStatsBucket) int {
+	ta, _ := a.Time()
+	tb, _ := b.Time()
+	return ta.Compare(tb)
+}
+
+// maxTime returns the later of the two times.
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
 }
 
 // mapQueryTypeToLabel maps query types to human-readable labels.
@@ -0,0 +1,276 @@
+package collector
+
+import (
+	"maps"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/umatare5/controld-exporter/internal/controld"
+)
+
+// testNow is the time of the runs in the tests, and testEnd the end of its last closed bucket.
+var (
+	testNow = time.Date(2026, time.January, 2, 12, 30, 30, 0, time.UTC)
+	testEnd = time.Date(2026, time.January, 2, 12, 29, 0, 0, time.UTC)
+)
+
+// bucketAt returns a bucket of the DNS queries report starting at the time.
+func bucketAt(ts time.Time, count map[string]int) controld.QueryStatsBucket {
+	return controld.QueryStatsBucket{Ts: strconv.FormatInt(ts.Unix(), 10), Count: count}
+}
+
+// queryStatsOf returns a DNS queries report made of the buckets.
+func queryStatsOf(buckets ...controld.QueryStatsBucket) *controld.QueryStatsResponse {
+	stats := &controld.QueryStatsResponse{Success: true}
+	stats.Body.Queries = buckets
+	return stats
+}
+
+// verdictCounts returns the counts of the verdicts exported by the stats module.
+func verdictCounts(blocked, bypassed, redirected float64) map[string]float64 {
+	return map[string]float64{"blocked": blocked, "bypassed": bypassed, "redirected": redirected}
+}
+
+func TestPendingRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		counter   *queryCounter
+		wantStart time.Time
+		wantOK    bool
+	}{
+		{
+			name:      "first run counts the last closed bucket",
+			wantStart: testEnd.Add(-statsGranularity),
+			wantOK:    true,
+		},
+		{
+			name:      "buckets closed since the last run",
+			counter:   &queryCounter{lastBucket: testEnd.Add(-3 * statsGranularity)},
+			wantStart: testEnd.Add(-2 * statsGranularity),
+			wantOK:    true,
+		},
+		{
+			name:      "no bucket closed since the last run",
+			counter:   &queryCounter{lastBucket: testEnd.Add(-statsGranularity)},
+			wantStart: testEnd,
+		},
+		{
+			name:      "gap longer than the backfill",
+			counter:   &queryCounter{lastBucket: testEnd.Add(-2 * statsMaxBackfill)},
+			wantStart: testEnd.Add(-statsMaxBackfill),
+			wantOK:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &queryCounters{counters: map[string]*queryCounter{}}
+			if tt.counter != nil {
+				q.counters["org1"] = tt.counter
+			}
+
+			start, end, ok := q.pendingRange("org1", testNow)
+
+			if !start.Equal(tt.wantStart) || !end.Equal(testEnd) || ok != tt.wantOK {
+				t.Errorf("pendingRange() = (%s, %s, %v), want (%s, %s, %v)", start, end, ok, tt.wantStart, testEnd, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestCountQueries(t *testing.T) {
+	tests := []struct {
+		name       string
+		counter    *queryCounter
+		stats      *controld.QueryStatsResponse
+		start      time.Time
+		wantTotals map[string]float64
+		wantLast   map[string]float64
+	}{
+		{
+			name:       "first run",
+			stats:      queryStatsOf(bucketAt(testEnd.Add(-statsGranularity), map[string]int{"0": 3, "1": 2})),
+			start:      testEnd.Add(-statsGranularity),
+			wantTotals: verdictCounts(3, 2, 0),
+			wantLast:   verdictCounts(3, 2, 0),
+		},
+		{
+			name: "no overlap with the buckets counted already",
+			counter: &queryCounter{
+				lastBucket: testEnd.Add(-3 * statsGranularity),
+				totals:     verdictCounts(10, 0, 0),
+			},
+			stats: queryStatsOf(
+				bucketAt(testEnd.Add(-3*statsGranularity), map[string]int{"0": 100}), // Counted by the last run
+				bucketAt(testEnd.Add(-2*statsGranularity), map[string]int{"0": 1}),
+				bucketAt(testEnd.Add(-statsGranularity), map[string]int{"3": 4}),
+				bucketAt(testEnd, map[string]int{"0": 100}), // Not closed yet
+			),
+			start:      testEnd.Add(-2 * statsGranularity),
+			wantTotals: verdictCounts(11, 0, 4),
+			wantLast:   verdictCounts(0, 0, 4),
+		},
+		{
+			name: "gap longer than the backfill",
+			counter: &queryCounter{
+				lastBucket: testEnd.Add(-2 * statsMaxBackfill),
+				totals:     verdictCounts(10, 0, 0),
+			},
+			stats: queryStatsOf(
+				bucketAt(testEnd.Add(-statsMaxBackfill-time.Hour), map[string]int{"0": 100}), // Older than the backfill
+				bucketAt(testEnd.Add(-time.Hour), map[string]int{"1": 5}),
+			),
+			start:      testEnd.Add(-statsMaxBackfill),
+			wantTotals: verdictCounts(10, 5, 0),
+			wantLast:   verdictCounts(0, 0, 0),
+		},
+		{
+			name: "out-of-order buckets",
+			stats: queryStatsOf(
+				bucketAt(testEnd.Add(-statsGranularity), map[string]int{"0": 1}),
+				bucketAt(testEnd.Add(-3*statsGranularity), map[string]int{"0": 2}),
+				bucketAt(testEnd.Add(-2*statsGranularity), map[string]int{"1": 3}),
+			),
+			start:      testEnd.Add(-3 * statsGranularity),
+			wantTotals: verdictCounts(3, 3, 0),
+			wantLast:   verdictCounts(1, 0, 0),
+		},
+		{
+			name:       "no queries reported",
+			stats:      queryStatsOf(),
+			start:      testEnd.Add(-statsGranularity),
+			wantTotals: verdictCounts(0, 0, 0),
+			wantLast:   verdictCounts(0, 0, 0),
+		},
+		{
+			name: "invalid and unknown buckets",
+			stats: queryStatsOf(
+				controld.QueryStatsBucket{Ts: "yesterday", Count: map[string]int{"0": 100}},
+				bucketAt(testEnd.Add(-statsGranularity), map[string]int{"2": 7}),
+			),
+			start:      testEnd.Add(-statsGranularity),
+			wantTotals: map[string]float64{"blocked": 0, "bypassed": 0, "redirected": 0, "unknown": 7},
+			wantLast:   map[string]float64{"blocked": 0, "bypassed": 0, "redirected": 0, "unknown": 7},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Collector{log: &logger{}}
+			q := &queryCounters{counters: map[string]*queryCounter{}}
+			if tt.counter != nil {
+				q.counters["org1"] = tt.counter
+			}
+
+			c.countQueries(q, tt.stats, "org1", tt.start, testEnd)
+
+			totals, last, ok := q.valuesOf("org1")
+			if !ok {
+				t.Fatal("valuesOf() found no counter")
+			}
+			if !maps.Equal(totals, tt.wantTotals) {
+				t.Errorf("totals = %v, want %v", totals, tt.wantTotals)
+			}
+			if !maps.Equal(last, tt.wantLast) {
+				t.Errorf("last = %v, want %v", last, tt.wantLast)
+			}
+			if lastBucket := q.counters["org1"].lastBucket; !lastBucket.Equal(testEnd.Add(-statsGranularity)) {
+				t.Errorf("lastBucket = %s, want %s", lastBucket, testEnd.Add(-statsGranularity))
+			}
+		})
+	}
+}
+
+func TestCountQueriesAfterConcurrentRun(t *testing.T) {
+	c := &Collector{log: &logger{}}
+	q := &queryCounters{}
+	stats := queryStatsOf(bucketAt(testEnd.Add(-statsGranularity), map[string]int{"0": 3}))
+
+	// Both runs computed the same range before either counted it.
+	start, end, _ := q.pendingRange("org1", testNow)
+	c.countQueries(q, stats, "org1", start, end)
+	c.countQueries(q, stats, "org1", start, end)
+
+	if totals, _, _ := q.valuesOf("org1"); totals["blocked"] != 3 {
+		t.Errorf("blocked = %v, want the bucket to be counted once", totals["blocked"])
+	}
+	if _, _, ok := q.pendingRange("org1", testNow); ok {
+		t.Error("pendingRange() reports buckets left after the range was counted")
+	}
+}
+
+func TestQueryCountersAdd(t *testing.T) {
+	tests := []struct {
+		name       string
+		counter    *queryCounter
+		start      time.Time
+		wantTotals map[string]float64
+	}{
+		{
+			name:       "first run",
+			start:      testEnd.Add(-statsGranularity),
+			wantTotals: map[string]float64{"JP": 2, "US": 1},
+		},
+		{
+			name:       "no overlap",
+			counter:    &queryCounter{lastBucket: testEnd.Add(-2 * statsGranularity), totals: map[string]float64{"JP": 5}},
+			start:      testEnd.Add(-statsGranularity),
+			wantTotals: map[string]float64{"JP": 7, "US": 1},
+		},
+		{
+			name:       "range counted by a concurrent run",
+			counter:    &queryCounter{lastBucket: testEnd.Add(-statsGranularity), totals: map[string]float64{"JP": 5}},
+			start:      testEnd.Add(-statsGranularity),
+			wantTotals: map[string]float64{"JP": 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &queryCounters{}
+			if tt.counter != nil {
+				q.counters = map[string]*queryCounter{"org1": tt.counter}
+			}
+
+			q.add("org1", map[string]float64{"JP": 2, "US": 1}, tt.start, testEnd)
+
+			totals, _, ok := q.valuesOf("org1")
+			if !ok {
+				t.Fatal("valuesOf() found no counter")
+			}
+			if !maps.Equal(totals, tt.wantTotals) {
+				t.Errorf("totals = %v, want %v", totals, tt.wantTotals)
+			}
+			if lastBucket := q.counters["org1"].lastBucket; !lastBucket.Equal(testEnd.Add(-statsGranularity)) {
+				t.Errorf("lastBucket = %s, want %s", lastBucket, testEnd.Add(-statsGranularity))
+			}
+		})
+	}
+}
+
+func TestStatsModuleWithFailingBreakdown(t *testing.T) {
+	server := newFakeAPI(t, map[string]fakeResponse{
+		controld.DnsQueriesReportEndpoint:     {status: http.StatusOK, body: emptyReportBody},
+		controld.DnsQueriesByCountryEndpoint:  {status: http.StatusNotFound, body: notFoundBody},
+		controld.DnsQueriesByProtocolEndpoint: {status: http.StatusOK, body: okBody(`{"queries":[{"key":"DoH","count":3}]}`)},
+	})
+	c := newTestCollector(server, Options{Mode: PersonalMode, RefreshIntervals: map[string]time.Duration{StatsModule: time.Minute}})
+
+	refreshModule(t, c, StatsModule)
+
+	counts := countMetrics(c, StatsModule)
+	if counts[controld_dns_queries_total] != len(queryVerdicts) {
+		t.Errorf("controld_dns_queries_total series = %d, want %d", counts[controld_dns_queries_total], len(queryVerdicts))
+	}
+	if counts[controld_dns_queries_by_protocol_total] != 1 {
+		t.Errorf("controld_dns_queries_by_protocol_total series = %d, want 1", counts[controld_dns_queries_by_protocol_total])
+	}
+	if counts[controld_dns_queries_by_country_total] != 0 {
+		t.Errorf("controld_dns_queries_by_country_total series = %d, want 0", counts[controld_dns_queries_by_country_total])
+	}
+	if success, ok := scrapeSuccessOf(c, StatsModule, dummyOrgId); !ok || !success {
+		t.Errorf("scrape success = (%v, %v), want the failing breakdown not to fail the module", success, ok)
+	}
+}
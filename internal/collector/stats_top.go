@@ -0,0 +1,188 @@
+// Package collector contains Prometheus metric collectors for the exporter.
+package collector
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/umatare5/controld-exporter/internal/controld"
+)
+
+const (
+	statsTopLogPrefix = "stats_top"
+)
+
+// Defaults and limits of the stats_top module.
+const (
+	DefaultTopWindow = time.Hour // Default period of the rankings
+	DefaultTopLimit  = 10        // Default number of entries exported per ranking
+	MaxTopLimit      = 100       // Hard cap of the number of entries exported per ranking
+)
+
+// TopOptions holds the settings of the stats_top module.
+type TopOptions struct {
+	Window        time.Duration  // Period of the rankings, ending at the last closed minute
+	Limit         int            // Number of entries exported per ranking, capped by MaxTopLimit
+	DomainInclude *regexp.Regexp // Only the domains matching it are ranked, if set
+	DomainExclude *regexp.Regexp // The domains matching it are not ranked, if set
+}
+
+// topRanking is a ranking of DNS queries exported by the stats_top module.
+type topRanking struct {
+	endpoint      string           // Report endpoint of the ranking
+	desc          *prometheus.Desc // Description of the metric of the ranking
+	filterDomains bool             // Whether the domain regular expressions apply to the ranking
+}
+
+// topRankings lists the rankings exported by the stats_top module.
+var topRankings = []topRanking{
+	{endpoint: controld.TopBlockedDomainsEndpoint, desc: controld_top_blocked_domains, filterDomains: true},
+	{endpoint: controld.TopFiltersEndpoint, desc: controld_top_filters},
+	{endpoint: controld.TopServicesEndpoint, desc: controld_top_services},
+}
+
+// topFetcher fetches a ranking of DNS queries of an organization.
+type topFetcher func(endpoint string, start, end time.Time, limit int) (*controld.CountsReportResponse, error)
+
+// collectTopStatsMetrics collects the rankings of DNS queries.
+func (c *Collector) collectTopStatsMetrics(ctx context.Context, ch chan<- prometheus.Metric) error {
+	if c.isRunningInPersonalMode() {
+		c.log.debug(statsTopLogPrefix, logSkipOrgScraping)
+		return c.collectPersonalTopStatsMetrics(ctx, ch)
+	}
+
+	// Organization metrics are only available in business mode.
+	org, err := c.fetchMainOrganization(ctx)
+	if err != nil {
+		c.log.info(statsTopLogPrefix, logNotFoundMainOrg)
+		return err
+	}
+	mainErr := c.collectMainOrgTopStatsMetrics(ctx, ch, org, org.Body.Organization.StatsEndpoint)
+
+	subOrgs, err := c.fetchSubOrganizations(ctx)
+	if err != nil {
+		recordSubOrgsFailure(ctx, err)
+		c.log.info(statsTopLogPrefix, logNotFoundSubOrgs)
+		return errors.Join(mainErr, err)
+	}
+	subErr := c.collectSubOrgTopStatsMetrics(ctx, ch, subOrgs, org.Body.Organization.StatsEndpoint)
+
+	return errors.Join(mainErr, subErr)
+}
+
+// collectPersonalTopStatsMetrics collects the rankings of DNS queries for the personal instance.
+func (c *Collector) collectPersonalTopStatsMetrics(ctx context.Context, ch chan<- prometheus.Metric) error {
+	return c.collectTopRankings(ctx, ch, dummyOrgId, errFetchingPersonalMetrics, func(endpoint string, start, end time.Time, limit int) (*controld.CountsReportResponse, error) {
+		return c.client.GetTopReport(ctx, personalStatsEndpoint, endpoint, start, end, limit)
+	})
+}
+
+// collectMainOrgTopStatsMetrics collects the rankings of DNS queries for the main organization.
+func (c *Collector) collectMainOrgTopStatsMetrics(ctx context.Context, ch chan<- prometheus.Metric, org *controld.OrganizationResponse, statsEndpoint string) error {
+	return c.collectTopRankings(ctx, ch, org.Body.Organization.PK, errFetchingMainOrgMetrics, func(endpoint string, start, end time.Time, limit int) (*controld.CountsReportResponse, error) {
+		return c.client.GetTopReport(ctx, statsEndpoint, endpoint, start, end, limit)
+	})
+}
+
+// collectSubOrgTopStatsMetrics collects the rankings of DNS queries for sub organizations.
+func (c *Collector) collectSubOrgTopStatsMetrics(ctx context.Context, ch chan<- prometheus.Metric, subOrgs *controld.SubOrganizationsResponse, statsEndpoint string) error {
+	return c.forEachSubOrg(ctx, extractSubOrganizationIDs(subOrgs), func(subOrgID string) error {
+		return c.collectTopRankings(ctx, ch, subOrgID, errFetchingSubOrgMetrics+subOrgID+": ", func(endpoint string, start, end time.Time, limit int) (*controld.CountsReportResponse, error) {
+			return c.client.GetSubOrgTopReport(ctx, statsEndpoint, subOrgID, endpoint, start, end, limit)
+		})
+	})
+}
+
+// collectTopRankings fetches each ranking of the organization over the window ending at the last closed minute.
+// More entries are requested when the domains are filtered, so that the ranking is still filled up to the limit.
+// A ranking which fails is logged and skipped without discarding the others, and is not recorded in the scrape status.
+// The organization only fails when no ranking is fetched.
+func (c *Collector) collectTopRankings(ctx context.Context, ch chan<- prometheus.Metric, orgID string, errPrefix string, fetch topFetcher) error {
+	end := time.Now().Add(-statsSettleDelay).Truncate(statsGranularity)
+	start := end.Add(-c.top.Window)
+
+	var errs []error
+	fetched := false
+	for _, ranking := range topRankings {
+		limit := c.top.Limit
+		if ranking.filterDomains && c.top.filtersDomains() {
+			limit = MaxTopLimit
+		}
+
+		report, err := fetch(ranking.endpoint, start, end, limit)
+		if err != nil && isNotEntitled(err) {
+			c.log.debug(statsTopLogPrefix, logModuleNotEntitled+"%s: %v", ranking.endpoint, err)
+			errs = append(errs, err)
+			continue
+		}
+		if err != nil {
+			c.log.error(statsTopLogPrefix, errPrefix+"%v", err)
+			errs = append(errs, err)
+			continue
+		}
+		fetched = true
+		c.storeTopMetrics(ch, ranking, report, orgID)
+	}
+	if fetched {
+		recordScrape(ctx, orgID, nil)
+		return nil
+	}
+
+	err := errors.Join(errs...)
+	recordScrape(ctx, orgID, err)
+	return err
+}
+
+// storeTopMetrics stores the entries of the ranking up to the limit in the Prometheus channel.
+// An entry ranked again is skipped, so that only its first rank is exported and it does not count toward the limit.
+func (c *Collector) storeTopMetrics(ch chan<- prometheus.Metric, ranking topRanking, report *controld.CountsReportResponse, orgID string) {
+	rank := 0
+	seen := map[string]bool{}
+	for _, entry := range report.Body.Queries {
+		if seen[entry.Key] || (ranking.filterDomains && !c.top.allowsDomain(entry.Key)) {
+			continue
+		}
+		seen[entry.Key] = true
+		if rank++; rank > c.top.Limit {
+			return
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			ranking.desc,
+			prometheus.GaugeValue,
+			float64(entry.Count),
+			entry.Key,
+			strconv.Itoa(rank),
+			orgID,
+		)
+	}
+}
+
+// filtersDomains checks if a regular expression is set to filter the domains.
+func (o TopOptions) filtersDomains() bool {
+	return o.DomainInclude != nil || o.DomainExclude != nil
+}
+
+// allowsDomain checks if the domain matches the include expression and does not match the exclude expression.
+func (o TopOptions) allowsDomain(domain string) bool {
+	if o.DomainInclude != nil && !o.DomainInclude.MatchString(domain) {
+		return false
+	}
+	return o.DomainExclude == nil || !o.DomainExclude.MatchString(domain)
+}
+
+// withTopDefaults fills the unset settings with the defaults and caps the limit.
+func (o TopOptions) withTopDefaults() TopOptions {
+	if o.Window <= 0 {
+		o.Window = DefaultTopWindow
+	}
+	if o.Limit <= 0 {
+		o.Limit = DefaultTopLimit
+	}
+	o.Limit = min(o.Limit, MaxTopLimit)
+	return o
+}
@@ -0,0 +1,131 @@
+package collector
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/umatare5/controld-exporter/internal/controld"
+)
+
+// rankingBody is a ranking of two entries returned by the fake API.
+var rankingBody = okBody(`{"queries":[{"key":"ads.example.com","count":5},{"key":"tracker.example.net","count":3}]}`)
+
+func TestStatsTopModuleWithFailingRanking(t *testing.T) {
+	ok := fakeResponse{status: http.StatusOK, body: rankingBody}
+	notFound := fakeResponse{status: http.StatusNotFound, body: notFoundBody}
+	serverError := fakeResponse{status: http.StatusInternalServerError, body: notFoundBody}
+
+	tests := []struct {
+		name        string
+		routes      map[string]fakeResponse
+		wantDomains int
+		wantFilters int
+		wantSuccess bool
+	}{
+		{
+			name: "every ranking succeeds",
+			routes: map[string]fakeResponse{
+				controld.TopBlockedDomainsEndpoint: ok,
+				controld.TopFiltersEndpoint:        ok,
+				controld.TopServicesEndpoint:       ok,
+			},
+			wantDomains: 2,
+			wantFilters: 2,
+			wantSuccess: true,
+		},
+		{
+			name: "a ranking is not found",
+			routes: map[string]fakeResponse{
+				controld.TopBlockedDomainsEndpoint: ok,
+				controld.TopFiltersEndpoint:        notFound,
+				controld.TopServicesEndpoint:       ok,
+			},
+			wantDomains: 2,
+			wantSuccess: true,
+		},
+		{
+			name: "a ranking fails on the server",
+			routes: map[string]fakeResponse{
+				controld.TopBlockedDomainsEndpoint: serverError,
+				controld.TopFiltersEndpoint:        ok,
+				controld.TopServicesEndpoint:       ok,
+			},
+			wantFilters: 2,
+			wantSuccess: true,
+		},
+		{
+			name: "every ranking fails",
+			routes: map[string]fakeResponse{
+				controld.TopBlockedDomainsEndpoint: notFound,
+				controld.TopFiltersEndpoint:        notFound,
+				controld.TopServicesEndpoint:       serverError,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCollector(newFakeAPI(t, tt.routes), Options{
+				Mode:             PersonalMode,
+				RefreshIntervals: map[string]time.Duration{StatsTopModule: time.Minute},
+				EnabledModules:   map[string]bool{StatsTopModule: true},
+			})
+
+			refreshModule(t, c, StatsTopModule)
+
+			counts := countMetrics(c, StatsTopModule)
+			if counts[controld_top_blocked_domains] != tt.wantDomains {
+				t.Errorf("controld_top_blocked_domains series = %d, want %d", counts[controld_top_blocked_domains], tt.wantDomains)
+			}
+			if counts[controld_top_filters] != tt.wantFilters {
+				t.Errorf("controld_top_filters series = %d, want %d", counts[controld_top_filters], tt.wantFilters)
+			}
+			if success, _ := scrapeSuccessOf(c, StatsTopModule, dummyOrgId); success != tt.wantSuccess {
+				t.Errorf("scrape success = %v, want %v", success, tt.wantSuccess)
+			}
+		})
+	}
+}
+
+func TestStoreTopMetrics(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		want  map[string]float64
+	}{
+		{name: "every entry", limit: 10, want: map[string]float64{"1": 5, "2": 4, "3": 1}},
+		{name: "duplicate entry does not count toward the limit", limit: 2, want: map[string]float64{"1": 5, "2": 4}},
+	}
+
+	// The ranking lists ads.example.com three times.
+	report := &controld.CountsReportResponse{}
+	body := `{"body":{"queries":[{"key":"ads.example.com","count":5},{"key":"ads.example.com","count":4},` +
+		`{"key":"tracker.example.net","count":4},{"key":"ads.example.com","count":2},{"key":"cdn.example.org","count":1}]}}`
+	if err := json.Unmarshal([]byte(body), report); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Collector{top: TopOptions{Limit: tt.limit}.withTopDefaults()}
+			ch := make(chan prometheus.Metric, 16)
+			c.storeTopMetrics(ch, topRankings[0], report, dummyOrgId)
+			close(ch)
+			metrics := []prometheus.Metric{}
+			for metric := range ch {
+				metrics = append(metrics, metric)
+			}
+
+			if got := labelValues(t, metrics, controld_top_blocked_domains, "rank"); !maps.Equal(got, tt.want) {
+				t.Errorf("controld_top_blocked_domains by rank = %v, want %v", got, tt.want)
+			}
+			if domains := labelValues(t, metrics, controld_top_blocked_domains, "domain"); len(domains) != len(tt.want) {
+				t.Errorf("controld_top_blocked_domains domains = %v, want %d distinct domains", domains, len(tt.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// Package collector contains Prometheus metric collectors for the exporter.
+package collector
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/umatare5/controld-exporter/internal/controld"
+)
+
+// errNotBusinessAccount is the entitlement error of the modules which require a business organization.
+var errNotBusinessAccount = errors.New("the API key does not belong to a business organization")
+
+// Validation holds what the API key gives access to.
+type Validation struct {
+	BusinessAccount bool             // Whether the API key belongs to a business organization
+	OrganizationID  string           // ID of the business organization, if any
+	Entitlements    map[string]error // Outcome of a request of each enabled module, nil when the plan includes it
+}
+
+// Validate checks that the API key is accepted, detects whether it belongs to a business organization and
+// sends a request of each enabled module to find the modules included in the plan of the account.
+// The error wraps *controld.UnauthorizedError when the API key is rejected.
+func (c *Collector) Validate(ctx context.Context) (*Validation, error) {
+	// Devices are available to every account, so a failure here is about the API key itself.
+	if _, err := c.client.GetDevices(ctx); err != nil {
+		return nil, err
+	}
+
+	org, err := c.detectBusinessAccount(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Validation{BusinessAccount: org != nil, Entitlements: map[string]error{}}
+	statsEndpoint := personalStatsEndpoint
+	if org != nil {
+		v.OrganizationID = org.Body.Organization.PK
+		statsEndpoint = org.Body.Organization.StatsEndpoint
+	}
+
+	for _, m := range c.modules {
+		v.Entitlements[m.name] = c.checkEntitlement(ctx, m.name, v.BusinessAccount, statsEndpoint)
+	}
+
+	return v, nil
+}
+
+// detectBusinessAccount fetches the main organization and caches it. It returns nil when the account is not a
+// business organization, which the API answers with a refusal (see isNoOrganization), and an error when the answer
+// is anything else, e.g. a revoked API key or an outage. The previous outcome is kept on error.
+// The outcome is used to choose the mode in auto mode.
+func (c *Collector) detectBusinessAccount(ctx context.Context) (*controld.OrganizationResponse, error) {
+	org, err := c.refreshMainOrganization(ctx)
+	if err != nil && !isNoOrganization(err) {
+		return nil, err
+	}
+	if err != nil {
+		org = nil // Rejected by the API, as the account has no organization
+	}
+
+	c.businessAccount.Store(org != nil)
+	c.modeDetected.Store(true)
+	return org, nil
+}
+
+// checkEntitlement sends a request of the module and returns its error, if any.
+func (c *Collector) checkEntitlement(ctx context.Context, name string, businessAccount bool, statsEndpoint string) error {
+	switch name {
+	case OrganizationModule:
+		if !businessAccount {
+			return errNotBusinessAccount
+		}
+		return nil
+	case BillingModule:
+		_, err := c.client.GetBillingSubscriptions(ctx)
+		return err
+	case EndpointModule, EndpointClientsModule:
+		return nil // Already checked with the API key
+	case ProfileModule:
+		_, err := c.client.GetProfiles(ctx)
+		return err
+	case ServiceModule:
+		_, err := c.client.GetServiceCategories(ctx)
+		return err
+	case StatsModule:
+		end := time.Now().Truncate(statsGranularity)
+		_, err := c.client.GetDnsQueriesReport(ctx, statsEndpoint, end.Add(-statsGranularity), end)
+		return err
+	case StatsTopModule:
+		end := time.Now().Truncate(statsGranularity)
+		_, err := c.client.GetTopReport(ctx, statsEndpoint, controld.TopBlockedDomainsEndpoint, end.Add(-statsGranularity), end, 1)
+		return err
+	default:
+		return nil // The network status is public
+	}
+}
@@ -0,0 +1,23 @@
+// Package config is responsible for the execution of the CLI.
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ReadAPIKeyFile reads the API key from the file. Surrounding whitespace such as a trailing newline is ignored.
+func ReadAPIKeyFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	apiKey := strings.TrimSpace(string(data))
+	if apiKey == "" {
+		return "", fmt.Errorf("API key file '%s' is empty", path)
+	}
+
+	return apiKey, nil
+}
@@ -2,59 +2,412 @@
 package config
 
 import (
-	"errors"
+	"fmt"
 	"log"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
-	"github.com/jinzhu/configor"
+	"github.com/prometheus/exporter-toolkit/web"
+	"github.com/umatare5/controld-exporter/internal/collector"
+	"github.com/umatare5/controld-exporter/internal/controld"
 	cli "github.com/urfave/cli/v3"
 )
 
 const (
-	WebListenAddressFlagName     = "web.listen-address"
-	WebListenPortFlagName        = "web.listen-port"
-	WebTelemetryPathFlagName     = "web.telemetry-path"
-	ControlDAPIKeyFlagName       = "controld.api-key"
-	ControlDBusinessModeFlagName = "controld.business-mode"
-	LogLevelFlagName             = "log.level"
+	ConfigFileFlagName                 = "config.file"
+	WebListenAddressFlagName           = "web.listen-address"
+	WebListenPortFlagName              = "web.listen-port"
+	WebTelemetryPathFlagName           = "web.telemetry-path"
+	WebConfigFileFlagName              = "web.config.file"
+	WebShutdownTimeoutFlagName         = "web.shutdown-timeout"
+	ControlDAPIKeyFlagName             = "controld.api-key"
+	ControlDAPIKeyFileFlagName         = "controld.api-key-file"
+	ControlDModeFlagName               = "controld.mode"
+	ControlDBusinessModeFlagName       = "controld.business-mode"
+	ControlDAPIURLFlagName             = "controld.api-url"
+	ControlDAnalyticsURLFlagName       = "controld.analytics-url"
+	ControlDProxyURLFlagName           = "controld.proxy-url"
+	ControlDUserAgentFlagName          = "controld.user-agent"
+	ControlDTimeoutFlagName            = "controld.timeout"
+	ControlDRetryMaxAttemptsFlagName   = "controld.retry.max-attempts"
+	ControlDRetryMaxElapsedFlagName    = "controld.retry.max-elapsed"
+	ControlDRateLimitFlagName          = "controld.rate-limit"
+	ControlDRateBurstFlagName          = "controld.rate-burst"
+	ControlDAnalyticsRateLimitFlagName = "controld.analytics.rate-limit"
+	ControlDAnalyticsRateBurstFlagName = "controld.analytics.rate-burst"
+	LogLevelFlagName                   = "log.level"
+	CollectorMaxConcurrencyFlagName    = "collector.max-concurrency"
+	CollectorTopWindowFlagName         = "collector.stats_top.window"
+	CollectorTopLimitFlagName          = "collector.stats_top.limit"
+	CollectorTopDomainIncludeFlagName  = "collector.stats_top.domain-include"
+	CollectorTopDomainExcludeFlagName  = "collector.stats_top.domain-exclude"
+	CollectorClientLimitFlagName       = "collector.endpoint_clients.limit"
+	ProbeConfigFileFlagName            = "probe.config-file"
 )
 
+// Modes of the collection.
+const (
+	PersonalMode = collector.PersonalMode // Collects the personal instance
+	BusinessMode = collector.BusinessMode // Collects the main organization and its sub-organizations
+	AutoMode     = collector.AutoMode     // Detects whether the API key belongs to a business organization
+)
+
+// Modes lists the modes which can be selected with the mode flag.
+var Modes = collector.Modes
+
+// CollectorModules lists the collector modules which can be configured individually.
+var CollectorModules = moduleNames(func(collector.ModuleInfo) bool { return true })
+
+// OptInCollectorModules lists the collector modules which are disabled by default, as they send many requests.
+var OptInCollectorModules = moduleNames(func(m collector.ModuleInfo) bool { return m.OptIn })
+
 // Config struct holds the configuration for the exporter.
 type Config struct {
-	WebListenAddress     string
-	WebListenPort        int
-	WebTelemetryPath     string
-	ControlDAPIKey       string
-	ControlDBusinessMode bool
-	LogLevel             string
+	WebListenAddress           string
+	WebListenPort              int
+	WebTelemetryPath           string
+	WebConfigFile              string
+	WebShutdownTimeout         time.Duration
+	ControlDAPIKey             string
+	ControlDAPIKeyFile         string
+	ControlDMode               string
+	ControlDBusinessMode       bool // Deprecated: selects the business mode unless the mode is set
+	ControlDAPIURL             string
+	ControlDAnalyticsURL       string
+	ControlDProxyURL           string
+	ControlDUserAgent          string
+	ControlDTimeout            time.Duration
+	ControlDRetryMaxAttempts   int
+	ControlDRetryMaxElapsed    time.Duration
+	ControlDRateLimit          float64
+	ControlDRateBurst          int
+	ControlDAnalyticsRateLimit float64
+	ControlDAnalyticsRateBurst int
+	LogLevel                   string
+	CollectorMaxConcurrency    int
+	CollectorTopWindow         time.Duration
+	CollectorTopLimit          int
+	CollectorTopDomainInclude  string
+	CollectorTopDomainExclude  string
+	CollectorClientLimit       int
+	ProbeConfigFile            string
+	ProbeTargets               map[string]ProbeTarget   // Accounts served by the probe endpoint, keyed by target name
+	RefreshIntervals           map[string]time.Duration // Polling interval for each collector module
+	EnabledModules             map[string]bool          // Whether each collector module is enabled
 }
 
 // NewConfig initializes a Config struct, loads configuration values, and validates the API key.
+// Flags and environment variables take precedence over the configuration file, which takes precedence over the defaults.
 func NewConfig(cli *cli.Command) Config {
 	config := Config{
-		WebListenAddress:     cli.String(WebListenAddressFlagName),
-		WebListenPort:        int(cli.Int(WebListenPortFlagName)),
-		WebTelemetryPath:     cli.String(WebTelemetryPathFlagName),
-		ControlDAPIKey:       cli.String(ControlDAPIKeyFlagName),
-		ControlDBusinessMode: cli.Bool(ControlDBusinessModeFlagName),
-		LogLevel:             cli.String(LogLevelFlagName),
+		WebListenAddress:           cli.String(WebListenAddressFlagName),
+		WebListenPort:              int(cli.Int(WebListenPortFlagName)),
+		WebTelemetryPath:           cli.String(WebTelemetryPathFlagName),
+		WebConfigFile:              cli.String(WebConfigFileFlagName),
+		WebShutdownTimeout:         cli.Duration(WebShutdownTimeoutFlagName),
+		ControlDAPIKey:             cli.String(ControlDAPIKeyFlagName),
+		ControlDAPIKeyFile:         cli.String(ControlDAPIKeyFileFlagName),
+		ControlDMode:               cli.String(ControlDModeFlagName),
+		ControlDBusinessMode:       cli.Bool(ControlDBusinessModeFlagName),
+		ControlDAPIURL:             cli.String(ControlDAPIURLFlagName),
+		ControlDAnalyticsURL:       cli.String(ControlDAnalyticsURLFlagName),
+		ControlDProxyURL:           cli.String(ControlDProxyURLFlagName),
+		ControlDUserAgent:          cli.String(ControlDUserAgentFlagName),
+		ControlDTimeout:            cli.Duration(ControlDTimeoutFlagName),
+		ControlDRetryMaxAttempts:   int(cli.Int(ControlDRetryMaxAttemptsFlagName)),
+		ControlDRetryMaxElapsed:    cli.Duration(ControlDRetryMaxElapsedFlagName),
+		ControlDRateLimit:          cli.Float(ControlDRateLimitFlagName),
+		ControlDRateBurst:          int(cli.Int(ControlDRateBurstFlagName)),
+		ControlDAnalyticsRateLimit: cli.Float(ControlDAnalyticsRateLimitFlagName),
+		ControlDAnalyticsRateBurst: int(cli.Int(ControlDAnalyticsRateBurstFlagName)),
+		LogLevel:                   cli.String(LogLevelFlagName),
+		CollectorMaxConcurrency:    int(cli.Int(CollectorMaxConcurrencyFlagName)),
+		CollectorTopWindow:         cli.Duration(CollectorTopWindowFlagName),
+		CollectorTopLimit:          int(cli.Int(CollectorTopLimitFlagName)),
+		CollectorTopDomainInclude:  cli.String(CollectorTopDomainIncludeFlagName),
+		CollectorTopDomainExclude:  cli.String(CollectorTopDomainExcludeFlagName),
+		CollectorClientLimit:       int(cli.Int(CollectorClientLimitFlagName)),
+		ProbeConfigFile:            cli.String(ProbeConfigFileFlagName),
+		RefreshIntervals:           map[string]time.Duration{},
+		EnabledModules:             map[string]bool{},
+	}
+
+	for _, module := range CollectorModules {
+		config.RefreshIntervals[module] = cli.Duration(RefreshIntervalFlagName(module))
+		config.EnabledModules[module] = cli.Bool(CollectorFlagName(module))
 	}
 
-	err := configor.New(&configor.Config{}).Load(&config)
+	file, err := loadConfigFile(cli.String(ConfigFileFlagName))
 	if err != nil {
 		log.Fatal(err)
 	}
+	applyConfigFile(cli, &config, file)
+
+	// The business mode flag is kept for compatibility and only applies when the mode is not set.
+	if config.ControlDBusinessMode && !cli.IsSet(ControlDModeFlagName) && file.ControlD.Mode == nil {
+		config.ControlDMode = BusinessMode
+	}
+
+	if err := isValidModeFlag(config.ControlDMode); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := isValidWebConfigFileFlag(config.WebConfigFile); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := isValidWebShutdownTimeoutFlag(config.WebShutdownTimeout); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := isValidAPIKeySourceFlags(config.ControlDAPIKey, config.ControlDAPIKeyFile); err != nil {
+		log.Fatal(err)
+	}
+
+	if config.ControlDAPIKeyFile != "" {
+		config.ControlDAPIKey, err = ReadAPIKeyFile(config.ControlDAPIKeyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	config.ProbeTargets, err = loadProbeTargets(config.ProbeConfigFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The API key is optional when the exporter only serves the targets of the probe endpoint.
+	if err := isValidControlDAPIKeyFlag(config.ControlDAPIKey, config.ProbeConfigFile); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := isValidURLFlag(ControlDAPIURLFlagName, config.ControlDAPIURL); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := isValidURLFlag(ControlDAnalyticsURLFlagName, expandAnalyticsURL(config.ControlDAnalyticsURL)); err != nil {
+		log.Fatal(err)
+	}
 
-	if err := isValidControlDAPIKeyFlag(config.ControlDAPIKey); err != nil {
+	if err := isValidURLFlag(ControlDProxyURLFlagName, config.ControlDProxyURL); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := isValidRetryFlags(config.ControlDRetryMaxAttempts, config.ControlDRetryMaxElapsed); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := isValidRateLimitFlags(ControlDRateLimitFlagName, config.ControlDRateLimit, ControlDRateBurstFlagName, config.ControlDRateBurst); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := isValidRateLimitFlags(ControlDAnalyticsRateLimitFlagName, config.ControlDAnalyticsRateLimit, ControlDAnalyticsRateBurstFlagName, config.ControlDAnalyticsRateBurst); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := isValidRefreshIntervalFlags(config.RefreshIntervals); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := isValidMaxConcurrencyFlag(config.CollectorMaxConcurrency); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := isValidTopFlags(config.CollectorTopWindow, config.CollectorTopLimit); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := isValidRegexpFlag(CollectorTopDomainIncludeFlagName, config.CollectorTopDomainInclude); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := isValidRegexpFlag(CollectorTopDomainExcludeFlagName, config.CollectorTopDomainExclude); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := isValidClientLimitFlag(config.CollectorClientLimit); err != nil {
 		log.Fatal(err)
 	}
 
 	return config
 }
 
-// isValidControlDAPIKeyFlag checks if the ControlD API key is set.
-func isValidControlDAPIKeyFlag(apikey string) error {
-	if apikey == "" {
-		return errors.New("Environment variable 'CTRLD_API_KEY' is not set")
+// CollectorFlagName returns the name of the flag to enable the module.
+func CollectorFlagName(module string) string {
+	return "collector." + module
+}
+
+// IsOptInCollectorModule checks if the module is disabled by default.
+func IsOptInCollectorModule(module string) bool {
+	return slices.Contains(OptInCollectorModules, module)
+}
+
+// moduleNames returns the names of the collector modules matching the filter.
+func moduleNames(filter func(collector.ModuleInfo) bool) []string {
+	names := []string{}
+	for _, m := range collector.Modules {
+		if filter(m) {
+			names = append(names, m.Name)
+		}
+	}
+	return names
+}
+
+// DefaultRefreshInterval returns the interval the module polls the Control D API at by default.
+func DefaultRefreshInterval(module string) time.Duration {
+	for _, m := range collector.Modules {
+		if m.Name == module {
+			return m.RefreshInterval
+		}
+	}
+	return 0
+}
+
+// RefreshIntervalFlagName returns the name of the flag for the polling interval of the module.
+func RefreshIntervalFlagName(module string) string {
+	return "collector." + module + ".refresh-interval"
+}
+
+// isValidControlDAPIKeyFlag checks if the ControlD API key is set, unless the targets of the probe endpoint are given.
+func isValidControlDAPIKeyFlag(apikey string, probeConfigFile string) error {
+	if apikey == "" && probeConfigFile == "" {
+		return fmt.Errorf("API key is not set. Use '--%s', '--%s', environment variable 'CTRLD_API_KEY' or 'controld.api_key' in '--%s', or define probe targets with '--%s'", ControlDAPIKeyFlagName, ControlDAPIKeyFileFlagName, ConfigFileFlagName, ProbeConfigFileFlagName)
+	}
+
+	return nil
+}
+
+// isValidModeFlag checks if the mode is one of the known modes.
+func isValidModeFlag(mode string) error {
+	if !slices.Contains(Modes, mode) {
+		return fmt.Errorf("Flag '--%s' must be one of %s", ControlDModeFlagName, strings.Join(Modes, ", "))
+	}
+
+	return nil
+}
+
+// isValidWebConfigFileFlag checks if the web configuration file is empty or holds a valid TLS and authentication setup.
+func isValidWebConfigFileFlag(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	if err := web.Validate(path); err != nil {
+		return fmt.Errorf("Flag '--%s' is invalid: %w", WebConfigFileFlagName, err)
+	}
+
+	return nil
+}
+
+// isValidWebShutdownTimeoutFlag checks if the in-flight requests are given some time to complete on shutdown.
+func isValidWebShutdownTimeoutFlag(timeout time.Duration) error {
+	if timeout <= 0 {
+		return fmt.Errorf("Flag '--%s' must be a positive duration", WebShutdownTimeoutFlagName)
+	}
+
+	return nil
+}
+
+// isValidAPIKeySourceFlags checks if the API key is not given both directly and by a file.
+func isValidAPIKeySourceFlags(apikey string, apikeyFile string) error {
+	if apikey != "" && apikeyFile != "" {
+		return fmt.Errorf("Flag '--%s' cannot be used together with '--%s' or environment variable 'CTRLD_API_KEY'", ControlDAPIKeyFileFlagName, ControlDAPIKeyFlagName)
+	}
+
+	return nil
+}
+
+// expandAnalyticsURL replaces the placeholder of the analytics URL template so that it can be parsed as a URL.
+func expandAnalyticsURL(template string) string {
+	return strings.ReplaceAll(template, controld.AnalyticsURLPlaceholder, "endpoint")
+}
+
+// isValidURLFlag checks if the flag is empty or holds an absolute HTTP(S) URL.
+func isValidURLFlag(name string, value string) error {
+	if value == "" {
+		return nil
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Flag '--%s' must be an absolute http or https URL", name)
+	}
+
+	return nil
+}
+
+// isValidRetryFlags checks if the retry policy allows at least one attempt within a positive budget.
+func isValidRetryFlags(maxAttempts int, maxElapsed time.Duration) error {
+	if maxAttempts < 1 {
+		return fmt.Errorf("Flag '--%s' must be at least 1", ControlDRetryMaxAttemptsFlagName)
+	}
+	if maxElapsed <= 0 {
+		return fmt.Errorf("Flag '--%s' must be a positive duration", ControlDRetryMaxElapsedFlagName)
+	}
+
+	return nil
+}
+
+// isValidRateLimitFlags checks if the rate is not negative and the burst allows at least one request.
+func isValidRateLimitFlags(rateName string, rate float64, burstName string, burst int) error {
+	if rate < 0 {
+		return fmt.Errorf("Flag '--%s' must not be negative", rateName)
+	}
+	if burst < 1 {
+		return fmt.Errorf("Flag '--%s' must be at least 1", burstName)
+	}
+
+	return nil
+}
+
+// isValidMaxConcurrencyFlag checks if at least one request can be sent at once.
+func isValidMaxConcurrencyFlag(maxConcurrency int) error {
+	if maxConcurrency < 1 {
+		return fmt.Errorf("Flag '--%s' must be at least 1", CollectorMaxConcurrencyFlagName)
+	}
+
+	return nil
+}
+
+// isValidTopFlags checks if the rankings cover a positive window and hold between 1 and the maximum number of entries.
+func isValidTopFlags(window time.Duration, limit int) error {
+	if window <= 0 {
+		return fmt.Errorf("Flag '--%s' must be a positive duration", CollectorTopWindowFlagName)
+	}
+	if limit < 1 || limit > collector.MaxTopLimit {
+		return fmt.Errorf("Flag '--%s' must be between 1 and %d", CollectorTopLimitFlagName, collector.MaxTopLimit)
+	}
+
+	return nil
+}
+
+// isValidClientLimitFlag checks if between 1 and the maximum number of clients are exported per device.
+func isValidClientLimitFlag(limit int) error {
+	if limit < 1 || limit > collector.MaxClientLimit {
+		return fmt.Errorf("Flag '--%s' must be between 1 and %d", CollectorClientLimitFlagName, collector.MaxClientLimit)
+	}
+
+	return nil
+}
+
+// isValidRegexpFlag checks if the flag is empty or holds a valid regular expression.
+func isValidRegexpFlag(name string, value string) error {
+	if _, err := regexp.Compile(value); err != nil {
+		return fmt.Errorf("Flag '--%s' must be a valid regular expression: %w", name, err)
+	}
+
+	return nil
+}
+
+// isValidRefreshIntervalFlags checks if no polling interval is a negative duration.
+func isValidRefreshIntervalFlags(intervals map[string]time.Duration) error {
+	for module, interval := range intervals {
+		if interval < 0 {
+			return fmt.Errorf("Flag '--%s' must not be a negative duration", RefreshIntervalFlagName(module))
+		}
 	}
 
 	return nil
@@ -0,0 +1,196 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/umatare5/controld-exporter/internal/collector"
+	"github.com/umatare5/controld-exporter/internal/controld"
+	cli "github.com/urfave/cli/v3"
+)
+
+// writeFile writes the content to the file of the name in a temporary directory and returns its path.
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return path
+}
+
+// listenPortOf returns the listen port set in the file, or zero when it is not set.
+func listenPortOf(file *fileConfig) int {
+	if file.Web.ListenPort == nil {
+		return 0
+	}
+	return *file.Web.ListenPort
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		wantErr  string
+		wantPort int
+	}{
+		{name: "yaml", file: "config.yml", content: "web:\n  listen_port: 9100\n", wantPort: 9100},
+		{name: "toml", file: "config.toml", content: "[web]\nlisten_port = 9100\n", wantPort: 9100},
+		{name: "empty file", file: "config.yml"},
+		{name: "unknown key in yaml", file: "config.yml", content: "web:\n  listen_prot: 9100\n", wantErr: "listen_prot"},
+		{name: "unknown key in toml", file: "config.toml", content: "[web]\nlisten_prot = 9100\n", wantErr: "listen_prot"},
+		{name: "unknown module", file: "config.yml", content: "collector:\n  modules:\n    stats_device:\n      enabled: true\n", wantErr: "unknown collector module 'stats_device'"},
+		{name: "invalid duration", file: "config.yml", content: "collector:\n  modules:\n    stats:\n      refresh_interval: often\n", wantErr: "often"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := loadConfigFile(writeFile(t, tt.file, tt.content))
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadConfigFile() error = %v, want an error mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadConfigFile() error = %v", err)
+			}
+			if port := listenPortOf(file); port != tt.wantPort {
+				t.Errorf("listen_port = %d, want %d", port, tt.wantPort)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFileMissing(t *testing.T) {
+	if _, err := loadConfigFile(filepath.Join(t.TempDir(), "config.yml")); err == nil {
+		t.Error("loadConfigFile() error = nil, want an error for a missing file")
+	}
+}
+
+func TestLoadConfigFileReadsOnlyTheFile(t *testing.T) {
+	path := writeFile(t, "config.yml", "web:\n  listen_port: 9100\n")
+	for _, env := range []string{"development", "production", "test"} {
+		if err := os.WriteFile(filepath.Join(filepath.Dir(path), "config."+env+".yml"), []byte("web:\n  listen_port: 9200\n"), 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+	t.Setenv("CONFIGOR_ENV", "production")
+	t.Setenv("CONFIGOR_WEB_LISTENPORT", "9300")
+	t.Setenv("WEB_LISTENPORT", "9400")
+
+	file, err := loadConfigFile(path)
+
+	if err != nil {
+		t.Fatalf("loadConfigFile() error = %v", err)
+	}
+	if port := listenPortOf(file); port != 9100 {
+		t.Errorf("listen_port = %d, want 9100 from the file only", port)
+	}
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		env          string
+		wantPort     int
+		wantInterval time.Duration
+		wantEnabled  bool
+	}{
+		{name: "file overrides the defaults", wantPort: 9100, wantInterval: 2 * time.Minute, wantEnabled: false},
+		{name: "flags take precedence over the file", args: []string{"--" + WebListenPortFlagName, "9200", "--" + RefreshIntervalFlagName(collector.StatsModule), "3m", "--" + CollectorFlagName(collector.StatsModule)}, wantPort: 9200, wantInterval: 3 * time.Minute, wantEnabled: true},
+		{name: "environment variables take precedence over the file", env: "9300", wantPort: 9300, wantInterval: 2 * time.Minute, wantEnabled: false},
+	}
+
+	path := writeFile(t, "config.yml", "web:\n  listen_port: 9100\ncollector:\n  modules:\n    stats:\n      enabled: false\n      refresh_interval: 2m\n")
+	file, err := loadConfigFile(path)
+	if err != nil {
+		t.Fatalf("loadConfigFile() error = %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				t.Setenv("TEST_WEB_LISTEN_PORT", tt.env)
+			}
+
+			var config Config
+			cmd := &cli.Command{
+				Flags: []cli.Flag{
+					&cli.IntFlag{Name: WebListenPortFlagName, Value: 10034, Sources: cli.EnvVars("TEST_WEB_LISTEN_PORT")},
+					&cli.DurationFlag{Name: RefreshIntervalFlagName(collector.StatsModule), Value: time.Minute},
+					&cli.BoolWithInverseFlag{Name: CollectorFlagName(collector.StatsModule), Value: true},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					config = Config{
+						WebListenPort:    int(cmd.Int(WebListenPortFlagName)),
+						RefreshIntervals: map[string]time.Duration{collector.StatsModule: cmd.Duration(RefreshIntervalFlagName(collector.StatsModule))},
+						EnabledModules:   map[string]bool{collector.StatsModule: cmd.Bool(CollectorFlagName(collector.StatsModule))},
+					}
+					applyConfigFile(cmd, &config, file)
+					return nil
+				},
+			}
+			if err := cmd.Run(context.Background(), append([]string{"controld-exporter"}, tt.args...)); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			if config.WebListenPort != tt.wantPort {
+				t.Errorf("WebListenPort = %d, want %d", config.WebListenPort, tt.wantPort)
+			}
+			if interval := config.RefreshIntervals[collector.StatsModule]; interval != tt.wantInterval {
+				t.Errorf("refresh interval = %s, want %s", interval, tt.wantInterval)
+			}
+			if enabled := config.EnabledModules[collector.StatsModule]; enabled != tt.wantEnabled {
+				t.Errorf("enabled = %v, want %v", enabled, tt.wantEnabled)
+			}
+		})
+	}
+}
+
+func TestValidators(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{name: "known mode", err: isValidModeFlag(AutoMode)},
+		{name: "unknown mode", err: isValidModeFlag("enterprise"), wantErr: true},
+		{name: "empty mode", err: isValidModeFlag(""), wantErr: true},
+		{name: "refresh intervals", err: isValidRefreshIntervalFlags(map[string]time.Duration{collector.StatsModule: time.Minute, "billing": 0})},
+		{name: "negative refresh interval", err: isValidRefreshIntervalFlags(map[string]time.Duration{collector.StatsModule: -time.Minute}), wantErr: true},
+		{name: "shutdown timeout", err: isValidWebShutdownTimeoutFlag(time.Second)},
+		{name: "zero shutdown timeout", err: isValidWebShutdownTimeoutFlag(0), wantErr: true},
+		{name: "API key and API key file", err: isValidAPIKeySourceFlags("key", "/run/secrets/key"), wantErr: true},
+		{name: "no API key without probe targets", err: isValidControlDAPIKeyFlag("", ""), wantErr: true},
+		{name: "no API key with probe targets", err: isValidControlDAPIKeyFlag("", "probe.yml")},
+		{name: "URL", err: isValidURLFlag(ControlDAPIURLFlagName, "https://api.controld.com")},
+		{name: "relative URL", err: isValidURLFlag(ControlDAPIURLFlagName, "api.controld.com"), wantErr: true},
+		{name: "analytics URL template", err: isValidURLFlag(ControlDAnalyticsURLFlagName, expandAnalyticsURL(controld.DefaultAnalyticsURL))},
+		{name: "no retry attempt", err: isValidRetryFlags(0, time.Minute), wantErr: true},
+		{name: "no retry budget", err: isValidRetryFlags(3, 0), wantErr: true},
+		{name: "negative rate limit", err: isValidRateLimitFlags(ControlDRateLimitFlagName, -1, ControlDRateBurstFlagName, 1), wantErr: true},
+		{name: "no burst", err: isValidRateLimitFlags(ControlDRateLimitFlagName, 1, ControlDRateBurstFlagName, 0), wantErr: true},
+		{name: "no concurrency", err: isValidMaxConcurrencyFlag(0), wantErr: true},
+		{name: "no top window", err: isValidTopFlags(0, 10), wantErr: true},
+		{name: "top limit over the maximum", err: isValidTopFlags(time.Hour, 1000), wantErr: true},
+		{name: "client limit over the maximum", err: isValidClientLimitFlag(100000), wantErr: true},
+		{name: "invalid regular expression", err: isValidRegexpFlag(CollectorTopDomainIncludeFlagName, "("), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if (tt.err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", tt.err, tt.wantErr)
+			}
+		})
+	}
+}
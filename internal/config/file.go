@@ -0,0 +1,203 @@
+// Package config is responsible for the execution of the CLI.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	cli "github.com/urfave/cli/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the layout of the configuration file. Settings missing from the file are nil.
+type fileConfig struct {
+	Web       fileWebConfig       `yaml:"web" toml:"web"`
+	ControlD  fileControlDConfig  `yaml:"controld" toml:"controld"`
+	Log       fileLogConfig       `yaml:"log" toml:"log"`
+	Collector fileCollectorConfig `yaml:"collector" toml:"collector"`
+	Probe     fileProbeConfig     `yaml:"probe" toml:"probe"`
+}
+
+// fileWebConfig is the layout of the settings of the HTTP server in the configuration file.
+type fileWebConfig struct {
+	ListenAddress   *string        `yaml:"listen_address" toml:"listen_address"`
+	ListenPort      *int           `yaml:"listen_port" toml:"listen_port"`
+	TelemetryPath   *string        `yaml:"telemetry_path" toml:"telemetry_path"`
+	ConfigFile      *string        `yaml:"config_file" toml:"config_file"`
+	ShutdownTimeout *time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+// fileControlDConfig is the layout of the settings of the Control D API in the configuration file.
+type fileControlDConfig struct {
+	APIKey       *string             `yaml:"api_key" toml:"api_key"`
+	APIKeyFile   *string             `yaml:"api_key_file" toml:"api_key_file"`
+	Mode         *string             `yaml:"mode" toml:"mode"`
+	BusinessMode *bool               `yaml:"business_mode" toml:"business_mode"`
+	APIURL       *string             `yaml:"api_url" toml:"api_url"`
+	AnalyticsURL *string             `yaml:"analytics_url" toml:"analytics_url"`
+	ProxyURL     *string             `yaml:"proxy_url" toml:"proxy_url"`
+	UserAgent    *string             `yaml:"user_agent" toml:"user_agent"`
+	Timeout      *time.Duration      `yaml:"timeout" toml:"timeout"`
+	Retry        fileRetryConfig     `yaml:"retry" toml:"retry"`
+	RateLimit    *float64            `yaml:"rate_limit" toml:"rate_limit"`
+	RateBurst    *int                `yaml:"rate_burst" toml:"rate_burst"`
+	Analytics    fileAnalyticsConfig `yaml:"analytics" toml:"analytics"`
+}
+
+// fileRetryConfig is the layout of the retry policy in the configuration file.
+type fileRetryConfig struct {
+	MaxAttempts *int           `yaml:"max_attempts" toml:"max_attempts"`
+	MaxElapsed  *time.Duration `yaml:"max_elapsed" toml:"max_elapsed"`
+}
+
+// fileAnalyticsConfig is the layout of the settings of the Control D Analytics API in the configuration file.
+type fileAnalyticsConfig struct {
+	RateLimit *float64 `yaml:"rate_limit" toml:"rate_limit"`
+	RateBurst *int     `yaml:"rate_burst" toml:"rate_burst"`
+}
+
+// fileLogConfig is the layout of the logging settings in the configuration file.
+type fileLogConfig struct {
+	Level *string `yaml:"level" toml:"level"`
+}
+
+// fileCollectorConfig is the layout of the settings of the collector in the configuration file.
+type fileCollectorConfig struct {
+	MaxConcurrency  *int                        `yaml:"max_concurrency" toml:"max_concurrency"`
+	StatsTop        fileStatsTopConfig          `yaml:"stats_top" toml:"stats_top"`
+	EndpointClients fileEndpointClientsConfig   `yaml:"endpoint_clients" toml:"endpoint_clients"`
+	Modules         map[string]fileModuleConfig `yaml:"modules" toml:"modules"` // Settings of each collector module, keyed by module name
+}
+
+// fileStatsTopConfig is the layout of the settings of the stats_top collector module in the configuration file.
+type fileStatsTopConfig struct {
+	Window        *time.Duration `yaml:"window" toml:"window"`
+	Limit         *int           `yaml:"limit" toml:"limit"`
+	DomainInclude *string        `yaml:"domain_include" toml:"domain_include"`
+	DomainExclude *string        `yaml:"domain_exclude" toml:"domain_exclude"`
+}
+
+// fileEndpointClientsConfig is the layout of the settings of the endpoint_clients collector module in the configuration file.
+type fileEndpointClientsConfig struct {
+	Limit *int `yaml:"limit" toml:"limit"`
+}
+
+// fileProbeConfig is the layout of the settings of the probe endpoint in the configuration file.
+type fileProbeConfig struct {
+	ConfigFile *string `yaml:"config_file" toml:"config_file"`
+}
+
+// fileModuleConfig is the layout of the settings of a collector module in the configuration file.
+type fileModuleConfig struct {
+	Enabled         *bool          `yaml:"enabled" toml:"enabled"`
+	RefreshInterval *time.Duration `yaml:"refresh_interval" toml:"refresh_interval"`
+}
+
+// loadConfigFile reads the YAML or TOML configuration file. Unknown keys are rejected.
+func loadConfigFile(path string) (*fileConfig, error) {
+	file := &fileConfig{}
+	if path == "" {
+		return file, nil
+	}
+
+	if err := decodeFile(path, file); err != nil {
+		return nil, fmt.Errorf("Failed to load '--%s': %w", ConfigFileFlagName, err)
+	}
+
+	for module := range file.Collector.Modules {
+		if !slices.Contains(CollectorModules, module) {
+			return nil, fmt.Errorf("Failed to load '--%s': unknown collector module '%s'", ConfigFileFlagName, module)
+		}
+	}
+
+	return file, nil
+}
+
+// decodeFile reads the TOML or JSON file, or the YAML file for any other extension, into the value.
+// Unknown keys are rejected. Only the file itself is read: no environment variable nor environment-specific file such
+// as config.production.yml is merged into it.
+func decodeFile(path string, value any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		metadata, err := toml.Decode(string(data), value)
+		if err != nil {
+			return err
+		}
+		if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("unknown key '%s'", undecoded[0])
+		}
+		return nil
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		return decoder.Decode(value)
+	default:
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(value); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		return nil
+	}
+}
+
+// applyConfigFile overrides the defaults of the configuration with the settings of the file.
+// Flags and environment variables take precedence over the file.
+func applyConfigFile(cli *cli.Command, config *Config, file *fileConfig) {
+	fromFile(cli, WebListenAddressFlagName, &config.WebListenAddress, file.Web.ListenAddress)
+	fromFile(cli, WebListenPortFlagName, &config.WebListenPort, file.Web.ListenPort)
+	fromFile(cli, WebTelemetryPathFlagName, &config.WebTelemetryPath, file.Web.TelemetryPath)
+	fromFile(cli, WebConfigFileFlagName, &config.WebConfigFile, file.Web.ConfigFile)
+	fromFile(cli, WebShutdownTimeoutFlagName, &config.WebShutdownTimeout, file.Web.ShutdownTimeout)
+	fromFile(cli, ControlDAPIKeyFlagName, &config.ControlDAPIKey, file.ControlD.APIKey)
+	fromFile(cli, ControlDAPIKeyFileFlagName, &config.ControlDAPIKeyFile, file.ControlD.APIKeyFile)
+	fromFile(cli, ControlDModeFlagName, &config.ControlDMode, file.ControlD.Mode)
+	fromFile(cli, ControlDBusinessModeFlagName, &config.ControlDBusinessMode, file.ControlD.BusinessMode)
+	fromFile(cli, ControlDAPIURLFlagName, &config.ControlDAPIURL, file.ControlD.APIURL)
+	fromFile(cli, ControlDAnalyticsURLFlagName, &config.ControlDAnalyticsURL, file.ControlD.AnalyticsURL)
+	fromFile(cli, ControlDProxyURLFlagName, &config.ControlDProxyURL, file.ControlD.ProxyURL)
+	fromFile(cli, ControlDUserAgentFlagName, &config.ControlDUserAgent, file.ControlD.UserAgent)
+	fromFile(cli, ControlDTimeoutFlagName, &config.ControlDTimeout, file.ControlD.Timeout)
+	fromFile(cli, ControlDRetryMaxAttemptsFlagName, &config.ControlDRetryMaxAttempts, file.ControlD.Retry.MaxAttempts)
+	fromFile(cli, ControlDRetryMaxElapsedFlagName, &config.ControlDRetryMaxElapsed, file.ControlD.Retry.MaxElapsed)
+	fromFile(cli, ControlDRateLimitFlagName, &config.ControlDRateLimit, file.ControlD.RateLimit)
+	fromFile(cli, ControlDRateBurstFlagName, &config.ControlDRateBurst, file.ControlD.RateBurst)
+	fromFile(cli, ControlDAnalyticsRateLimitFlagName, &config.ControlDAnalyticsRateLimit, file.ControlD.Analytics.RateLimit)
+	fromFile(cli, ControlDAnalyticsRateBurstFlagName, &config.ControlDAnalyticsRateBurst, file.ControlD.Analytics.RateBurst)
+	fromFile(cli, LogLevelFlagName, &config.LogLevel, file.Log.Level)
+	fromFile(cli, CollectorMaxConcurrencyFlagName, &config.CollectorMaxConcurrency, file.Collector.MaxConcurrency)
+	fromFile(cli, CollectorTopWindowFlagName, &config.CollectorTopWindow, file.Collector.StatsTop.Window)
+	fromFile(cli, CollectorTopLimitFlagName, &config.CollectorTopLimit, file.Collector.StatsTop.Limit)
+	fromFile(cli, CollectorTopDomainIncludeFlagName, &config.CollectorTopDomainInclude, file.Collector.StatsTop.DomainInclude)
+	fromFile(cli, CollectorTopDomainExcludeFlagName, &config.CollectorTopDomainExclude, file.Collector.StatsTop.DomainExclude)
+	fromFile(cli, CollectorClientLimitFlagName, &config.CollectorClientLimit, file.Collector.EndpointClients.Limit)
+	fromFile(cli, ProbeConfigFileFlagName, &config.ProbeConfigFile, file.Probe.ConfigFile)
+
+	for module, settings := range file.Collector.Modules {
+		enabled, interval := config.EnabledModules[module], config.RefreshIntervals[module]
+		fromFile(cli, CollectorFlagName(module), &enabled, settings.Enabled)
+		fromFile(cli, RefreshIntervalFlagName(module), &interval, settings.RefreshInterval)
+		config.EnabledModules[module], config.RefreshIntervals[module] = enabled, interval
+	}
+}
+
+// fromFile replaces the value with the one of the file unless the flag is set on the command line or by the environment.
+func fromFile[T any](cli *cli.Command, name string, value *T, file *T) {
+	if file != nil && !cli.IsSet(name) {
+		*value = *file
+	}
+}
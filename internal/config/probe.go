@@ -0,0 +1,135 @@
+// Package config is responsible for the execution of the CLI.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ProbeTarget holds the settings of a Control D account served by the probe endpoint.
+type ProbeTarget struct {
+	APIKey     string   `yaml:"api_key" toml:"api_key" json:"api_key"`                // API key of the account
+	APIKeyFile string   `yaml:"api_key_file" toml:"api_key_file" json:"api_key_file"` // File containing the API key of the account, re-read to pick up rotated keys
+	Mode       string   `yaml:"mode" toml:"mode" json:"mode"`                         // Mode of the account, personal, business or auto
+	Modules    []string `yaml:"modules" toml:"modules" json:"modules"`                // Collector modules served for the account, or all modules except the opt-in ones when empty
+}
+
+// EnabledModules returns whether each collector module is enabled for the target.
+func (t ProbeTarget) EnabledModules() map[string]bool {
+	enabled := map[string]bool{}
+	for _, module := range CollectorModules {
+		enabled[module] = (len(t.Modules) == 0 && !IsOptInCollectorModule(module)) || slices.Contains(t.Modules, module)
+	}
+	return enabled
+}
+
+// probeConfig is the layout of the file defining the targets of the probe endpoint.
+type probeConfig struct {
+	Targets map[string]ProbeTarget `yaml:"targets" toml:"targets" json:"targets"` // Targets keyed by the name passed in the target parameter
+}
+
+// loadProbeTargets reads the targets of the probe endpoint from the YAML, TOML or JSON file.
+func loadProbeTargets(path string) (map[string]ProbeTarget, error) {
+	if path == "" {
+		return map[string]ProbeTarget{}, nil
+	}
+
+	probe := probeConfig{}
+	if err := decodeFile(path, &probe); err != nil {
+		return nil, fmt.Errorf("Failed to load '--%s': %w", ProbeConfigFileFlagName, err)
+	}
+
+	// The YAML and TOML parsers reject the targets defined twice, but the JSON one silently keeps the last.
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if err := isUniqueJSONProbeTargets(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(probe.Targets) == 0 {
+		return nil, fmt.Errorf("Failed to load '--%s': no targets are defined", ProbeConfigFileFlagName)
+	}
+
+	for name, target := range probe.Targets {
+		if err := isValidProbeTarget(name, target); err != nil {
+			return nil, err
+		}
+		if target.APIKeyFile != "" {
+			apiKey, err := ReadAPIKeyFile(target.APIKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("Probe target '%s' has an invalid api_key_file: %w", name, err)
+			}
+			target.APIKey = apiKey
+			probe.Targets[name] = target
+		}
+	}
+
+	return probe.Targets, nil
+}
+
+// isValidProbeTarget checks if the target has a name, a single source of API key, a known mode and known modules.
+func isValidProbeTarget(name string, target ProbeTarget) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("Probe targets must have a name")
+	}
+	if target.APIKey != "" && target.APIKeyFile != "" {
+		return fmt.Errorf("Probe target '%s' cannot set both api_key and api_key_file", name)
+	}
+	if target.APIKey == "" && target.APIKeyFile == "" {
+		return fmt.Errorf("Probe target '%s' has no api_key or api_key_file", name)
+	}
+	if !slices.Contains(Modes, target.Mode) {
+		return fmt.Errorf("Probe target '%s' must set mode to one of %s", name, strings.Join(Modes, ", "))
+	}
+	for _, module := range target.Modules {
+		if !slices.Contains(CollectorModules, module) {
+			return fmt.Errorf("Probe target '%s' has an unknown module '%s'", name, module)
+		}
+	}
+
+	return nil
+}
+
+// isUniqueJSONProbeTargets checks that no target is defined twice in the JSON file.
+func isUniqueJSONProbeTargets(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Failed to load '--%s': %w", ProbeConfigFileFlagName, err)
+	}
+
+	var file struct {
+		Targets json.RawMessage `json:"targets"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil || len(file.Targets) == 0 {
+		return nil // Reported by decodeFile
+	}
+
+	// Walk the keys of the targets object, skipping the value of each target.
+	decoder := json.NewDecoder(strings.NewReader(string(file.Targets)))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil // Reported by decodeFile
+	}
+	seen := map[string]bool{}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil // Reported by decodeFile
+		}
+		name, _ := token.(string)
+		if seen[name] {
+			return fmt.Errorf("Probe target '%s' is defined more than once", name)
+		}
+		seen[name] = true
+
+		var target json.RawMessage
+		if err := decoder.Decode(&target); err != nil {
+			return nil // Reported by decodeFile
+		}
+	}
+
+	return nil
+}
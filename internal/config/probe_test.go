@@ -0,0 +1,173 @@
+package config
+
+import (
+	"maps"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadProbeTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+		want    map[string]ProbeTarget
+	}{
+		{
+			name:    "yaml",
+			file:    "probe.yml",
+			content: "targets:\n  a:\n    api_key: key-a\n    mode: business\n  b:\n    api_key: key-b\n    mode: personal\n    modules: [stats]\n",
+			want: map[string]ProbeTarget{
+				"a": {APIKey: "key-a", Mode: BusinessMode},
+				"b": {APIKey: "key-b", Mode: PersonalMode, Modules: []string{"stats"}},
+			},
+		},
+		{
+			name:    "toml",
+			file:    "probe.toml",
+			content: "[targets.a]\napi_key = \"key-a\"\nmode = \"auto\"\n",
+			want:    map[string]ProbeTarget{"a": {APIKey: "key-a", Mode: AutoMode}},
+		},
+		{
+			name:    "json",
+			file:    "probe.json",
+			content: `{"targets":{"a":{"api_key":"key-a","mode":"personal"}}}`,
+			want:    map[string]ProbeTarget{"a": {APIKey: "key-a", Mode: PersonalMode}},
+		},
+		{
+			name:    "duplicate target in yaml",
+			file:    "probe.yml",
+			content: "targets:\n  a:\n    api_key: key-a\n    mode: personal\n  a:\n    api_key: key-b\n    mode: personal\n",
+			wantErr: "already defined",
+		},
+		{
+			name:    "duplicate target in toml",
+			file:    "probe.toml",
+			content: "[targets.a]\napi_key = \"key-a\"\nmode = \"personal\"\n[targets.a]\napi_key = \"key-b\"\nmode = \"personal\"\n",
+			wantErr: "already",
+		},
+		{
+			name:    "duplicate target in json",
+			file:    "probe.json",
+			content: `{"targets":{"a":{"api_key":"key-a","mode":"personal"},"a":{"api_key":"key-b","mode":"personal"}}}`,
+			wantErr: "Probe target 'a' is defined more than once",
+		},
+		{
+			name:    "unknown key",
+			file:    "probe.yml",
+			content: "targets:\n  a:\n    apikey: key-a\n    mode: personal\n",
+			wantErr: "apikey",
+		},
+		{
+			name:    "unknown module",
+			file:    "probe.yml",
+			content: "targets:\n  a:\n    api_key: key-a\n    mode: personal\n    modules: [stats_device]\n",
+			wantErr: "Probe target 'a' has an unknown module 'stats_device'",
+		},
+		{
+			name:    "invalid mode",
+			file:    "probe.yml",
+			content: "targets:\n  a:\n    api_key: key-a\n    mode: enterprise\n",
+			wantErr: "Probe target 'a' must set mode",
+		},
+		{
+			name:    "missing mode",
+			file:    "probe.yml",
+			content: "targets:\n  a:\n    api_key: key-a\n",
+			wantErr: "Probe target 'a' must set mode",
+		},
+		{
+			name:    "both api_key and api_key_file",
+			file:    "probe.yml",
+			content: "targets:\n  a:\n    api_key: key-a\n    api_key_file: /run/secrets/a\n    mode: personal\n",
+			wantErr: "cannot set both api_key and api_key_file",
+		},
+		{
+			name:    "no API key",
+			file:    "probe.yml",
+			content: "targets:\n  a:\n    mode: personal\n",
+			wantErr: "has no api_key or api_key_file",
+		},
+		{
+			name:    "missing api_key_file",
+			file:    "probe.yml",
+			content: "targets:\n  a:\n    api_key_file: /nonexistent/key\n    mode: personal\n",
+			wantErr: "Probe target 'a' has an invalid api_key_file",
+		},
+		{
+			name:    "no targets",
+			file:    "probe.yml",
+			content: "targets: {}\n",
+			wantErr: "no targets are defined",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets, err := loadProbeTargets(writeFile(t, tt.file, tt.content))
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadProbeTargets() error = %v, want an error mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadProbeTargets() error = %v", err)
+			}
+			if !maps.EqualFunc(targets, tt.want, equalProbeTargets) {
+				t.Errorf("loadProbeTargets() = %v, want %v", targets, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadProbeTargetsReadsAPIKeyFile(t *testing.T) {
+	keyFile := writeFile(t, "key", "key-a\n")
+	path := writeFile(t, "probe.yml", "targets:\n  a:\n    api_key_file: "+keyFile+"\n    mode: personal\n")
+
+	targets, err := loadProbeTargets(path)
+
+	if err != nil {
+		t.Fatalf("loadProbeTargets() error = %v", err)
+	}
+	if target := targets["a"]; target.APIKey != "key-a" || target.APIKeyFile != keyFile {
+		t.Errorf("target = %+v, want the API key read from %s", target, keyFile)
+	}
+}
+
+func TestLoadProbeTargetsMissingFile(t *testing.T) {
+	if _, err := loadProbeTargets(filepath.Join(t.TempDir(), "probe.yml")); err == nil {
+		t.Error("loadProbeTargets() error = nil, want an error for a missing file")
+	}
+}
+
+func TestProbeTargetEnabledModules(t *testing.T) {
+	tests := []struct {
+		name    string
+		modules []string
+		want    func(module string) bool
+	}{
+		{name: "all modules except the opt-in ones by default", want: func(module string) bool { return !IsOptInCollectorModule(module) }},
+		{name: "listed modules only", modules: []string{"stats", "stats_top"}, want: func(module string) bool { return module == "stats" || module == "stats_top" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enabled := ProbeTarget{Modules: tt.modules}.EnabledModules()
+
+			for _, module := range CollectorModules {
+				if enabled[module] != tt.want(module) {
+					t.Errorf("module %s enabled = %v, want %v", module, enabled[module], tt.want(module))
+				}
+			}
+		})
+	}
+}
+
+// equalProbeTargets checks if the targets have the same settings.
+func equalProbeTargets(a, b ProbeTarget) bool {
+	return a.APIKey == b.APIKey && a.APIKeyFile == b.APIKeyFile && a.Mode == b.Mode && strings.Join(a.Modules, ",") == strings.Join(b.Modules, ",")
+}
@@ -1,6 +1,8 @@
 // Package controld provides a client for interacting with the ControlD API.
 package controld
 
+import "context"
+
 const (
 	BillingPaymentsEndpoint      = "/billing/payments"      // Endpoint for retrieving billing payments
 	BillingSubscriptionsEndpoint = "/billing/subscriptions" // Endpoint for retrieving billing subscriptions
@@ -76,31 +78,23 @@ type BillingSubscriptionsResponse struct {
 }
 
 // GetBillingPayments fetches billing payments data from the API.
-func (t *Client) GetBillingPayments() (*BillingPaymentsResponse, error) {
+func (t *Client) GetBillingPayments(ctx context.Context) (*BillingPaymentsResponse, error) {
 	var data BillingPaymentsResponse
-	err := t.sendAPIRequest(BillingPaymentsEndpoint, nil, &data)
+	err := t.sendAPIRequest(ctx, BillingPaymentsEndpoint, nil, &data)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := t.handleAPIError(BillingPaymentsEndpoint, data.Success); err != nil {
-		return nil, err
-	}
-
 	return &data, nil
 }
 
 // GetBillingSubscriptions fetches billing subscriptions data from the API.
-func (t *Client) GetBillingSubscriptions() (*BillingSubscriptionsResponse, error) {
+func (t *Client) GetBillingSubscriptions(ctx context.Context) (*BillingSubscriptionsResponse, error) {
 	var data BillingSubscriptionsResponse
-	err := t.sendAPIRequest(BillingSubscriptionsEndpoint, nil, &data)
+	err := t.sendAPIRequest(ctx, BillingSubscriptionsEndpoint, nil, &data)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := t.handleAPIError(BillingSubscriptionsEndpoint, data.Success); err != nil {
-		return nil, err
-	}
-
 	return &data, nil
 }
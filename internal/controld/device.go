@@ -1,6 +1,8 @@
 // Package controld provides a client for interacting with the ControlD API.
 package controld
 
+import "context"
+
 const (
 	DevicesEndpoint = "/devices" // Endpoint for retrieving device information
 )
@@ -50,19 +52,19 @@ type DevicesResponse struct {
 }
 
 // GetDevices retrieves devices without additional headers.
-func (t *Client) GetDevices() (*DevicesResponse, error) {
-	return t.sendDevicesRequest(nil)
+func (t *Client) GetDevices(ctx context.Context) (*DevicesResponse, error) {
+	return t.sendDevicesRequest(ctx, nil)
 }
 
 // GetSubOrgDevices retrieves devices with additional headers for a specific organization.
-func (t *Client) GetSubOrgDevices(orgID string) (*DevicesResponse, error) {
-	return t.sendDevicesRequest(t.buildOrgIDHeader(orgID))
+func (t *Client) GetSubOrgDevices(ctx context.Context, orgID string) (*DevicesResponse, error) {
+	return t.sendDevicesRequest(ctx, t.buildOrgIDHeader(orgID))
 }
 
 // sendDevicesRequest sends a request to fetch devices.
-func (t *Client) sendDevicesRequest(headers map[string]string) (*DevicesResponse, error) {
+func (t *Client) sendDevicesRequest(ctx context.Context, headers map[string]string) (*DevicesResponse, error) {
 	var data DevicesResponse
-	err := t.sendAPIRequest(DevicesEndpoint, headers, &data)
+	err := t.sendAPIRequest(ctx, DevicesEndpoint, headers, &data)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,121 @@
+// Package controld provides a client for interacting with the ControlD API.
+package controld
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// APIError describes a request which the ControlD API answered with a failure.
+type APIError struct {
+	Status   int    // HTTP status code of the response
+	Endpoint string // Endpoint of the request
+	OrgID    string // Organization ID the request was made for, if any
+	Code     string // Error code returned by the API, if any
+	Message  string // Error message returned by the API, if any
+}
+
+// Error returns a description of the failure.
+func (e *APIError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "API request to %s failed with HTTP status %d", e.Endpoint, e.Status)
+	if e.OrgID != "" {
+		fmt.Fprintf(&b, " for organization %s", e.OrgID)
+	}
+	if e.Code != "" {
+		fmt.Fprintf(&b, " (code %s)", e.Code)
+	}
+	if e.Message != "" {
+		fmt.Fprintf(&b, ": %s", e.Message)
+	}
+	return b.String()
+}
+
+// UnauthorizedError is returned when the API key is missing, invalid or revoked.
+type UnauthorizedError struct{ APIError }
+
+// Unwrap returns the underlying APIError.
+func (e *UnauthorizedError) Unwrap() error { return &e.APIError }
+
+// ForbiddenError is returned when the API key is not allowed to use the endpoint, e.g. the plan is not entitled to it.
+type ForbiddenError struct{ APIError }
+
+// Unwrap returns the underlying APIError.
+func (e *ForbiddenError) Unwrap() error { return &e.APIError }
+
+// NotFoundError is returned when the endpoint or the requested resource does not exist.
+type NotFoundError struct{ APIError }
+
+// Unwrap returns the underlying APIError.
+func (e *NotFoundError) Unwrap() error { return &e.APIError }
+
+// RateLimitedError is returned when the API rejected the request because of its rate limit.
+type RateLimitedError struct {
+	APIError
+	RetryAfter time.Duration // Delay requested by the API before the next request, if any
+}
+
+// Unwrap returns the underlying APIError.
+func (e *RateLimitedError) Unwrap() error { return &e.APIError }
+
+// ServerError is returned when the API failed to handle the request.
+type ServerError struct{ APIError }
+
+// Unwrap returns the underlying APIError.
+func (e *ServerError) Unwrap() error { return &e.APIError }
+
+// DecodeError is returned when the response of the API cannot be decoded.
+type DecodeError struct {
+	Endpoint string // Endpoint of the request
+	OrgID    string // Organization ID the request was made for, if any
+	Err      error  // Underlying decoding error
+}
+
+// Error returns a description of the failure.
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode the response of %s: %v", e.Endpoint, e.Err)
+}
+
+// Unwrap returns the underlying decoding error.
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// errorBody represents the error object returned by the ControlD API on failures.
+type errorBody struct {
+	Success bool `json:"success"` // Indicates if the API request was successful
+	Error   struct {
+		Code    json.RawMessage `json:"code"`    // Error code, either a number or a string
+		Message string          `json:"message"` // Human-readable error message
+	} `json:"error"`
+}
+
+// newAPIError classifies the failed response by its HTTP status and returns the matching error type.
+func newAPIError(resp *apiResponse, endpoint string, orgID string) error {
+	var body errorBody
+	_ = json.Unmarshal(resp.body, &body) // The error object is optional
+
+	apiErr := APIError{
+		Status:   resp.status,
+		Endpoint: endpoint,
+		OrgID:    orgID,
+		Code:     strings.Trim(string(body.Error.Code), `"`),
+		Message:  body.Error.Message,
+	}
+
+	switch {
+	case resp.status == http.StatusUnauthorized:
+		return &UnauthorizedError{apiErr}
+	case resp.status == http.StatusForbidden:
+		return &ForbiddenError{apiErr}
+	case resp.status == http.StatusNotFound:
+		return &NotFoundError{apiErr}
+	case resp.status == http.StatusTooManyRequests:
+		return &RateLimitedError{APIError: apiErr, RetryAfter: parseRetryAfter(resp.header)}
+	case resp.status >= http.StatusInternalServerError:
+		return &ServerError{apiErr}
+	default:
+		return &apiErr
+	}
+}
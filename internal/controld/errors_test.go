@@ -0,0 +1,153 @@
+package controld
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewAPIError(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		header  http.Header
+		body    string
+		wantErr any
+	}{
+		{name: "unauthorized", status: http.StatusUnauthorized, wantErr: new(*UnauthorizedError)},
+		{name: "forbidden", status: http.StatusForbidden, wantErr: new(*ForbiddenError)},
+		{name: "not found", status: http.StatusNotFound, wantErr: new(*NotFoundError)},
+		{name: "rate limited", status: http.StatusTooManyRequests, wantErr: new(*RateLimitedError)},
+		{name: "internal server error", status: http.StatusInternalServerError, wantErr: new(*ServerError)},
+		{name: "service unavailable", status: http.StatusServiceUnavailable, wantErr: new(*ServerError)},
+		{name: "other client error", status: http.StatusBadRequest, wantErr: new(*APIError)},
+		{name: "failure reported with 200", status: http.StatusOK, wantErr: new(*APIError)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &apiResponse{status: tt.status, header: tt.header, body: []byte(failureBody)}
+			err := newAPIError(resp, DevicesEndpoint, "org1")
+
+			if !errors.As(err, tt.wantErr) {
+				t.Fatalf("newAPIError() = %T, want %T", err, tt.wantErr)
+			}
+
+			// Every typed error wraps the APIError, so that its details stay available.
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("newAPIError() = %T, want it to wrap *APIError", err)
+			}
+			if apiErr.Status != tt.status || apiErr.Endpoint != DevicesEndpoint || apiErr.OrgID != "org1" {
+				t.Errorf("APIError = %+v, want status %d, endpoint %s and organization org1", apiErr, tt.status, DevicesEndpoint)
+			}
+			if apiErr.Code != "50000" || apiErr.Message != "failure" {
+				t.Errorf("APIError code = %q, message = %q, want 50000 and failure", apiErr.Code, apiErr.Message)
+			}
+		})
+	}
+}
+
+func TestNewAPIErrorSurvivesWrapping(t *testing.T) {
+	resp := &apiResponse{status: http.StatusForbidden, body: []byte(failureBody)}
+	err := fmt.Errorf("collecting: %w", errors.Join(errors.New("other"), newAPIError(resp, DevicesEndpoint, "")))
+
+	var forbidden *ForbiddenError
+	if !errors.As(err, &forbidden) {
+		t.Fatalf("errors.As(%v) did not find *ForbiddenError", err)
+	}
+	var unauthorized *UnauthorizedError
+	if errors.As(err, &unauthorized) {
+		t.Fatalf("errors.As(%v) found *UnauthorizedError", err)
+	}
+}
+
+func TestNewAPIErrorRetryAfter(t *testing.T) {
+	resp := &apiResponse{status: http.StatusTooManyRequests, header: http.Header{"Retry-After": []string{"7"}}}
+	err := newAPIError(resp, DevicesEndpoint, "")
+
+	var rateLimited *RateLimitedError
+	if !errors.As(err, &rateLimited) {
+		t.Fatalf("newAPIError() = %T, want *RateLimitedError", err)
+	}
+	if rateLimited.RetryAfter != 7*time.Second {
+		t.Errorf("RetryAfter = %s, want 7s", rateLimited.RetryAfter)
+	}
+}
+
+func TestNewAPIErrorCode(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		code string
+	}{
+		{name: "numeric code", body: `{"success":false,"error":{"code":40300,"message":"denied"}}`, code: "40300"},
+		{name: "string code", body: `{"success":false,"error":{"code":"forbidden","message":"denied"}}`, code: "forbidden"},
+		{name: "no error object", body: `not json`, code: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newAPIError(&apiResponse{status: http.StatusForbidden, body: []byte(tt.body)}, DevicesEndpoint, "")
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("newAPIError() = %T, want it to wrap *APIError", err)
+			}
+			if apiErr.Code != tt.code {
+				t.Errorf("Code = %q, want %q", apiErr.Code, tt.code)
+			}
+		})
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	server, _ := newSequenceServer(t, []testResponse{{status: http.StatusOK, body: `{"success":true,`}})
+	client := newTestClient(server, testRetryPolicy)
+
+	_, err := client.GetDevices(context.Background())
+
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("GetDevices() error = %v (%T), want *DecodeError", err, err)
+	}
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("DecodeError does not wrap the JSON error: %v", err)
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		t.Errorf("DecodeError wraps an *APIError, want it to be told apart from API failures")
+	}
+}
+
+func TestFailureReportedWithSuccessStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		get  func(client *Client) error
+	}{
+		{name: "organization", get: func(client *Client) error { _, err := client.GetMainOrganization(context.Background()); return err }},
+		{name: "sub-organizations", get: func(client *Client) error { _, err := client.GetSubOrganizations(context.Background()); return err }},
+		{name: "billing payments", get: func(client *Client) error { _, err := client.GetBillingPayments(context.Background()); return err }},
+		{name: "billing subscriptions", get: func(client *Client) error { _, err := client.GetBillingSubscriptions(context.Background()); return err }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := newSequenceServer(t, []testResponse{{status: http.StatusOK, body: failureBody}})
+			err := tt.get(newTestClient(server, testRetryPolicy))
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("error = %v (%T), want *APIError", err, err)
+			}
+			if apiErr.Status != http.StatusOK || apiErr.Code != "50000" || apiErr.Message != "failure" {
+				t.Errorf("APIError = %+v, want the status, code and message of the response", apiErr)
+			}
+		})
+	}
+}
@@ -7,8 +7,15 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/umatare5/controld-exporter/internal/log"
+	"golang.org/x/time/rate"
+)
+
+const (
+	orgIDHeader = "X-Force-Org-Id" // Header to run the request on behalf of a sub-organization
 )
 
 // isSuccess checks if the "success" field in the response is true.
@@ -17,36 +24,84 @@ func isSuccess(response map[string]any) bool {
 	return ok && success
 }
 
+// isContextDone checks if the context has been canceled or its deadline has been exceeded.
+func isContextDone(ctx context.Context) bool {
+	return ctx.Err() != nil
+}
+
 // buildOrgIDHeader creates a header map containing the "X-Force-Org-Id" field.
 func (t *Client) buildOrgIDHeader(orgID string) map[string]string {
-	return map[string]string{"X-Force-Org-Id": orgID}
+	return map[string]string{orgIDHeader: orgID}
+}
+
+// apiResponse holds the parts of an HTTP response needed to decode and classify it.
+type apiResponse struct {
+	status int         // HTTP status code
+	header http.Header // HTTP response headers
+	body   []byte      // Raw response body
 }
 
 // sendAPIRequest constructs the full URI and delegates the request to sendRequest.
-func (t *Client) sendAPIRequest(endpoint string, headers map[string]string, result any) error {
+func (t *Client) sendAPIRequest(ctx context.Context, endpoint string, headers map[string]string, result any) error {
 	uri := t.baseURL + endpoint
-	return t.sendRequest(uri, headers, result)
+	return t.sendRequest(ctx, t.apiLimiter, endpoint, uri, headers, result)
 }
 
 // sendReportAPIRequest constructs the full URI for Analytics API and delegates the request to sendRequest.
-func (t *Client) sendReportAPIRequest(stats_endpoint, endpoint string, headers map[string]string, result any) error {
-	uri := "https://" + stats_endpoint + ".analytics.controld.com" + endpoint
-	return t.sendRequest(uri, headers, result)
+func (t *Client) sendReportAPIRequest(ctx context.Context, stats_endpoint, endpoint string, headers map[string]string, result any) error {
+	uri := strings.ReplaceAll(t.analyticsURL, AnalyticsURLPlaceholder, stats_endpoint) + endpoint
+	return t.sendRequest(ctx, t.analyticsLimiter, endpoint, uri, headers, result)
 }
 
-// sendRequest performs an HTTP request, handles errors, and decodes the response into the result.
-func (t *Client) sendRequest(uri string, headers map[string]string, result any) error {
+// sendRequest performs an HTTP request with retries, handles errors, and decodes the response into the result.
+// Every attempt waits for the rate limiter of the host first.
+func (t *Client) sendRequest(ctx context.Context, limiter *rate.Limiter, endpoint string, uri string, headers map[string]string, result any) error {
 	log.Debugf("Sending request to URI: %s, headers: %s", uri, headers) // Debug log for the request URI
 
-	req, err := t.createRequest(uri, headers)
+	endpoint = trimQuery(endpoint)
+	orgID := headers[orgIDHeader]
+	deadline := time.Now().Add(t.retryPolicy.MaxElapsed)
+
+	for attempts := 1; ; attempts++ {
+		if err := waitLimiter(ctx, limiter); err != nil {
+			log.Debugf("Request to %s was aborted while waiting for the rate limiter: %s", uri, err)
+			return err
+		}
+
+		resp, err := t.doRequest(ctx, uri, headers)
+		if isContextDone(ctx) {
+			log.Debugf("Request to %s was aborted: %s", uri, ctx.Err())
+			return ctx.Err()
+		}
+		t.stats.recordRequest(endpoint, resp)
+		if !t.shouldRetry(http.MethodGet, resp, err) || !t.retryPolicy.hasAttemptsLeft(attempts) {
+			return t.finishRequest(resp, err, endpoint, uri, orgID, result)
+		}
+
+		delay := t.retryPolicy.backoff(attempts, retryAfterOf(resp))
+		if time.Now().Add(delay).After(deadline) {
+			log.Debugf("Giving up retrying %s: the retry budget is exhausted", uri)
+			return t.finishRequest(resp, err, endpoint, uri, orgID, result)
+		}
+
+		log.Debugf("Retrying request to %s in %s (attempt %d/%d)", uri, delay, attempts+1, t.retryPolicy.MaxAttempts)
+		t.stats.recordRetry(endpoint)
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// doRequest sends a single HTTP request and reads the whole response.
+func (t *Client) doRequest(ctx context.Context, uri string, headers map[string]string) (*apiResponse, error) {
+	req, err := t.createRequest(ctx, uri, headers)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := t.httpClient.Do(req)
 	if err != nil {
-		log.Errorf("Error sending request to %s: %s", uri, err)
-		return err
+		return nil, err
 	}
 	defer func() {
 		if closeErr := resp.Body.Close(); closeErr != nil {
@@ -54,46 +109,82 @@ func (t *Client) sendRequest(uri string, headers map[string]string, result any)
 		}
 	}()
 
-	return t.handleResponse(resp, uri, result)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiResponse{status: resp.StatusCode, header: resp.Header, body: body}, nil
 }
 
-func (t *Client) createRequest(url string, headers map[string]string) (*http.Request, error) {
-	req, err := http.NewRequestWithContext(context.Background(), "GET", url, nil)
+// shouldRetry checks if the attempt failed transiently and can be retried.
+func (t *Client) shouldRetry(method string, resp *apiResponse, err error) bool {
+	if !isRetryableMethod(method) {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return isRetryableStatus(resp.status)
+}
+
+// finishRequest logs the failure of the last attempt or decodes its response into the result.
+func (t *Client) finishRequest(resp *apiResponse, err error, endpoint string, uri string, orgID string, result any) error {
+	if err != nil {
+		log.Errorf("Error sending request to %s: %s", uri, err)
+		return err
+	}
+	return t.handleResponse(resp, endpoint, orgID, result)
+}
+
+func (t *Client) createRequest(ctx context.Context, url string, headers map[string]string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", t.apiKey))
+	req.Header.Set("User-Agent", t.userAgent)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", t.getAPIKey()))
 	for key, value := range headers {
 		req.Header.Set(key, value)
 	}
 	return req, nil
 }
 
-func (t *Client) handleResponse(resp *http.Response, endpoint string, result any) error {
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Errorf("Error reading response body: %s", err)
-		return err
+// handleResponse converts a failed response into a typed error or decodes the response into the result.
+func (t *Client) handleResponse(resp *apiResponse, endpoint string, orgID string, result any) error {
+	log.Debugf("Raw JSON response: %s", string(resp.body))
+
+	if resp.status >= http.StatusBadRequest {
+		return newAPIError(resp, endpoint, orgID)
 	}
-	log.Debugf("Raw JSON response: %s", string(body))
 
 	var rawResponse map[string]any
-	if err := json.Unmarshal(body, &rawResponse); err != nil {
+	if err := json.Unmarshal(resp.body, &rawResponse); err != nil {
 		log.Errorf("Error parsing JSON: %s", err)
-		return err
+		return &DecodeError{Endpoint: endpoint, OrgID: orgID, Err: err}
 	}
 
-	if err := t.handleAPIError(endpoint, isSuccess(rawResponse)); err != nil {
-		return err
+	if !isSuccess(rawResponse) {
+		return newAPIError(resp, endpoint, orgID)
 	}
 
-	return json.Unmarshal(body, result)
+	if err := json.Unmarshal(resp.body, result); err != nil {
+		return &DecodeError{Endpoint: endpoint, OrgID: orgID, Err: err}
+	}
+	return nil
 }
 
-func (t *Client) handleAPIError(endpoint string, success bool) error {
-	if !success {
-		return fmt.Errorf("API response indicates failure for endpoint: %s", endpoint)
+// retryAfterOf returns the delay requested by the Retry-After header of the response, if any.
+func retryAfterOf(resp *apiResponse) time.Duration {
+	if resp == nil {
+		return 0
 	}
-	return nil
+	return parseRetryAfter(resp.header)
+}
+
+// trimQuery removes the query string from the endpoint.
+func trimQuery(endpoint string) string {
+	path, _, _ := strings.Cut(endpoint, "?")
+	return path
 }
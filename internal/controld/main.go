@@ -1,16 +1,116 @@
 // Package controld provides a client for interacting with the ControlD API.
 package controld
 
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	DefaultBaseURL          = "https://api.controld.com"                  // Default base URL of the ControlD API
+	DefaultAnalyticsURL     = "https://{endpoint}.analytics.controld.com" // Default URL template of the ControlD Analytics API
+	DefaultUserAgent        = "controld-exporter"                         // Default User-Agent header sent to the API
+	AnalyticsURLPlaceholder = "{endpoint}"                                // Placeholder replaced with the stats endpoint of the organization
+)
+
 // Client represents a client for making requests to the ControlD API.
 type Client struct {
-	baseURL string // Base URL of the ControlD API
-	apiKey  string // API key for authentication
+	baseURL          string        // Base URL of the ControlD API
+	analyticsURL     string        // URL template of the ControlD Analytics API
+	apiKey           string        // API key for authentication
+	apiKeyMu         sync.RWMutex  // Mutex to protect access to the API key while it is rotated
+	httpClient       *http.Client  // HTTP client used to send requests
+	userAgent        string        // User-Agent header sent with each request
+	timeout          time.Duration // Timeout applied to each request
+	retryPolicy      RetryPolicy   // Policy to retry failed requests
+	stats            *RequestStats // Counters of the requests sent by the client
+	apiLimiter       *rate.Limiter // Rate limiter shared by the requests to the ControlD API
+	analyticsLimiter *rate.Limiter // Rate limiter shared by the requests to the ControlD Analytics API
+}
+
+// Option configures optional settings of the Client.
+type Option func(*Client)
+
+// WithBaseURL overrides the base URL of the ControlD API.
+func WithBaseURL(baseURL string) Option {
+	return func(t *Client) {
+		t.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithAnalyticsURL overrides the URL template of the ControlD Analytics API.
+// The placeholder "{endpoint}" is replaced with the stats endpoint of the organization.
+func WithAnalyticsURL(analyticsURL string) Option {
+	return func(t *Client) {
+		t.analyticsURL = strings.TrimSuffix(analyticsURL, "/")
+	}
+}
+
+// WithHTTPClient overrides the HTTP client used to send requests.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(t *Client) {
+		t.httpClient = httpClient
+	}
+}
+
+// WithUserAgent overrides the User-Agent header sent with each request.
+func WithUserAgent(userAgent string) Option {
+	return func(t *Client) {
+		t.userAgent = userAgent
+	}
+}
+
+// WithTimeout sets the timeout applied to each request.
+func WithTimeout(timeout time.Duration) Option {
+	return func(t *Client) {
+		t.timeout = timeout
+	}
 }
 
 // NewClient initializes and returns a new ControlD API client.
-func NewClient(apiKey string) *Client {
-	return &Client{
-		baseURL: "https://api.controld.com",
-		apiKey:  apiKey,
+func NewClient(apiKey string, opts ...Option) *Client {
+	t := &Client{
+		baseURL:          DefaultBaseURL,
+		analyticsURL:     DefaultAnalyticsURL,
+		apiKey:           apiKey,
+		httpClient:       http.DefaultClient,
+		userAgent:        DefaultUserAgent,
+		retryPolicy:      DefaultRetryPolicy,
+		stats:            &RequestStats{},
+		apiLimiter:       newLimiter(DefaultRateLimit),
+		analyticsLimiter: newLimiter(DefaultRateLimit),
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	// Copy the HTTP client so that the timeout does not leak into a shared client.
+	if t.timeout > 0 {
+		httpClient := *t.httpClient
+		httpClient.Timeout = t.timeout
+		t.httpClient = &httpClient
 	}
+
+	return t
+}
+
+// SetAPIKey replaces the API key used by the subsequent requests.
+func (t *Client) SetAPIKey(apiKey string) {
+	t.apiKeyMu.Lock()
+	defer t.apiKeyMu.Unlock()
+
+	t.apiKey = apiKey
+}
+
+// getAPIKey returns the API key used to authenticate the requests.
+func (t *Client) getAPIKey() string {
+	t.apiKeyMu.RLock()
+	defer t.apiKeyMu.RUnlock()
+
+	return t.apiKey
 }
@@ -0,0 +1,73 @@
+// Package controld provides a client for interacting with the ControlD API.
+package controld
+
+import (
+	"maps"
+	"strconv"
+	"sync"
+)
+
+const (
+	transportErrorCode = "error" // Code recorded when no HTTP response was received
+)
+
+// RequestKey identifies a series of requests by endpoint and HTTP status code.
+type RequestKey struct {
+	Endpoint string // Endpoint of the requests
+	Code     string // HTTP status code of the responses, or "error" when no response was received
+}
+
+// RequestStats holds the counters of the requests sent by the client.
+type RequestStats struct {
+	mu       sync.Mutex
+	requests map[RequestKey]uint64 // Number of requests by endpoint and HTTP status code
+	retries  map[string]uint64     // Number of retried requests by endpoint
+}
+
+// Requests returns a copy of the number of requests by endpoint and HTTP status code.
+func (s *RequestStats) Requests() map[RequestKey]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return maps.Clone(s.requests)
+}
+
+// Retries returns a copy of the number of retried requests by endpoint.
+func (s *RequestStats) Retries() map[string]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return maps.Clone(s.retries)
+}
+
+// recordRequest increments the number of requests for the endpoint and the outcome of the attempt.
+func (s *RequestStats) recordRequest(endpoint string, resp *apiResponse) {
+	code := transportErrorCode
+	if resp != nil {
+		code = strconv.Itoa(resp.status)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.requests == nil {
+		s.requests = map[RequestKey]uint64{}
+	}
+	s.requests[RequestKey{Endpoint: endpoint, Code: code}]++
+}
+
+// recordRetry increments the number of retried requests for the endpoint.
+func (s *RequestStats) recordRetry(endpoint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.retries == nil {
+		s.retries = map[string]uint64{}
+	}
+	s.retries[endpoint]++
+}
+
+// Stats returns the counters of the requests sent by the client.
+func (t *Client) Stats() *RequestStats {
+	return t.stats
+}
@@ -1,6 +1,8 @@
 // Package controld provides a client for interacting with the ControlD API.
 package controld
 
+import "context"
+
 const (
 	NetworkEndpoint = "/network" // API endpoint for network information
 )
@@ -29,9 +31,9 @@ type NetworkResponse struct {
 }
 
 // GetNetwork retrieves network information.
-func (t *Client) GetNetwork() (*NetworkResponse, error) {
+func (t *Client) GetNetwork(ctx context.Context) (*NetworkResponse, error) {
 	var data NetworkResponse
-	err := t.sendAPIRequest(NetworkEndpoint, nil, &data)
+	err := t.sendAPIRequest(ctx, NetworkEndpoint, nil, &data)
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,8 @@
 // Package controld provides a client for interacting with the ControlD API.
 package controld
 
+import "context"
+
 const (
 	OrganizationEndpoint     = "/organizations/organization"      // Endpoint for retrieving main organization data
 	SubOrganizationsEndpoint = "/organizations/sub_organizations" // Endpoint for retrieving sub organization data
@@ -112,31 +114,23 @@ type SubOrganizationsResponse struct {
 }
 
 // GetMainOrganization fetches the list of main organization.
-func (t *Client) GetMainOrganization() (*OrganizationResponse, error) {
+func (t *Client) GetMainOrganization(ctx context.Context) (*OrganizationResponse, error) {
 	var data OrganizationResponse
-	err := t.sendAPIRequest(OrganizationEndpoint, nil, &data)
+	err := t.sendAPIRequest(ctx, OrganizationEndpoint, nil, &data)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := t.handleAPIError(OrganizationEndpoint, data.Success); err != nil {
-		return nil, err
-	}
-
 	return &data, nil
 }
 
 // GetSubOrganizations fetches the list of sub organization.
-func (t *Client) GetSubOrganizations() (*SubOrganizationsResponse, error) {
+func (t *Client) GetSubOrganizations(ctx context.Context) (*SubOrganizationsResponse, error) {
 	var data SubOrganizationsResponse
-	err := t.sendAPIRequest(SubOrganizationsEndpoint, nil, &data)
+	err := t.sendAPIRequest(ctx, SubOrganizationsEndpoint, nil, &data)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := t.handleAPIError(SubOrganizationsEndpoint, data.Success); err != nil {
-		return nil, err
-	}
-
 	return &data, nil
 }
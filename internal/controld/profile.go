@@ -1,6 +1,8 @@
 // Package controld provides a client for interacting with the ControlD API.
 package controld
 
+import "context"
+
 const (
 	ProfilesEndpoint = "/profiles" // Endpoint for retrieving profiles
 )
@@ -45,19 +47,19 @@ type ProfilesResponse struct {
 }
 
 // GetProfiles retrieves profiles without additional headers.
-func (t *Client) GetProfiles() (*ProfilesResponse, error) {
-	return t.sendProfilesRequest(nil)
+func (t *Client) GetProfiles(ctx context.Context) (*ProfilesResponse, error) {
+	return t.sendProfilesRequest(ctx, nil)
 }
 
 // GetSubOrgProfiles retrieves profiles with additional headers for a specific organization.
-func (t *Client) GetSubOrgProfiles(orgID string) (*ProfilesResponse, error) {
-	return t.sendProfilesRequest(t.buildOrgIDHeader(orgID))
+func (t *Client) GetSubOrgProfiles(ctx context.Context, orgID string) (*ProfilesResponse, error) {
+	return t.sendProfilesRequest(ctx, t.buildOrgIDHeader(orgID))
 }
 
 // sendProfilesRequest sends a request to fetch profiles.
-func (t *Client) sendProfilesRequest(headers map[string]string) (*ProfilesResponse, error) {
+func (t *Client) sendProfilesRequest(ctx context.Context, headers map[string]string) (*ProfilesResponse, error) {
 	var data ProfilesResponse
-	err := t.sendAPIRequest(ProfilesEndpoint, headers, &data)
+	err := t.sendAPIRequest(ctx, ProfilesEndpoint, headers, &data)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,47 @@
+// Package controld provides a client for interacting with the ControlD API.
+package controld
+
+import (
+	"context"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimit configures a token bucket shared by all requests sent to the same host.
+type RateLimit struct {
+	RequestsPerSecond float64 // Rate at which tokens are refilled, or zero to disable the limit
+	Burst             int     // Maximum number of requests sent at once
+}
+
+// DefaultRateLimit is the rate limit used for both the API and the Analytics API when none is configured.
+var DefaultRateLimit = RateLimit{
+	RequestsPerSecond: 5,
+	Burst:             10,
+}
+
+// WithRateLimit overrides the rate limit of the requests to the ControlD API.
+func WithRateLimit(limit RateLimit) Option {
+	return func(t *Client) {
+		t.apiLimiter = newLimiter(limit)
+	}
+}
+
+// WithAnalyticsRateLimit overrides the rate limit of the requests to the ControlD Analytics API.
+func WithAnalyticsRateLimit(limit RateLimit) Option {
+	return func(t *Client) {
+		t.analyticsLimiter = newLimiter(limit)
+	}
+}
+
+// newLimiter returns a token bucket for the rate limit, or an unlimited one when the rate is zero.
+func newLimiter(limit RateLimit) *rate.Limiter {
+	if limit.RequestsPerSecond <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	return rate.NewLimiter(rate.Limit(limit.RequestsPerSecond), max(limit.Burst, 1))
+}
+
+// waitLimiter blocks until the limiter allows a request or the context is done.
+func waitLimiter(ctx context.Context, limiter *rate.Limiter) error {
+	return limiter.Wait(ctx)
+}
@@ -2,59 +2,155 @@
 package controld
 
 import (
+	"context"
 	"fmt"
+	"strconv"
 	"time"
 )
 
 const (
-	DnsQueriesReportEndpoint = "/reports/dns-queries/all-by-verdict/time-series" // Endpoint for DNS query statistics
+	DnsQueriesReportEndpoint     = "/reports/dns-queries/all-by-verdict/time-series" // Endpoint for DNS query statistics
+	TopBlockedDomainsEndpoint    = "/reports/dns-queries/top-blocked-domains"        // Endpoint for the most blocked domains
+	TopFiltersEndpoint           = "/reports/dns-queries/top-filters"                // Endpoint for the filters blocking the most DNS queries
+	TopServicesEndpoint          = "/reports/dns-queries/top-services"               // Endpoint for the services queried the most
+	DnsQueriesByCountryEndpoint  = "/reports/dns-queries/by-country"                 // Endpoint for DNS queries by destination country
+	DnsQueriesByProtocolEndpoint = "/reports/dns-queries/by-protocol"                // Endpoint for DNS queries by protocol
 )
 
 // QueryStatsResponse represents the response structure for DNS query statistics.
 type QueryStatsResponse struct {
 	Success bool `json:"success"`
 	Body    struct {
-		EndTs       int    `json:"endTs"`
-		StartTs     int    `json:"startTs"`
-		Granularity string `json:"granularity"`
-		Tz          string `json:"tz"`
-		Queries     []struct {
-			Ts    string         `json:"ts"`
-			Count map[string]int `json:"count"`
+		EndTs       int                `json:"endTs"`
+		StartTs     int                `json:"startTs"`
+		Granularity string             `json:"granularity"`
+		Tz          string             `json:"tz"`
+		Queries     []QueryStatsBucket `json:"queries"`
+	} `json:"body"`
+}
+
+// QueryStatsBucket represents the number of DNS queries by verdict in a time bucket.
+type QueryStatsBucket struct {
+	Ts    string         `json:"ts"`
+	Count map[string]int `json:"count"`
+}
+
+// CountsReportResponse represents the response structure for DNS queries counted by key,
+// such as a ranking of the most blocked domains or a breakdown by country.
+type CountsReportResponse struct {
+	Success bool `json:"success"`
+	Body    struct {
+		EndTs   int `json:"endTs"`
+		StartTs int `json:"startTs"`
+		Queries []struct {
+			Key   string `json:"key"`   // Domain, filter, service, country or protocol
+			Count int    `json:"count"` // Number of DNS queries
 		} `json:"queries"`
 	} `json:"body"`
 }
 
-// GetDnsQueriesReport fetches DNS query statisticswithout additional headers.
-func (t *Client) GetDnsQueriesReport(stats_endpoint string) (*QueryStatsResponse, error) {
+// Time parses the start of the bucket, given either as RFC 3339 or as Unix time in seconds or milliseconds.
+func (b QueryStatsBucket) Time() (time.Time, error) {
+	if ts, err := strconv.ParseInt(b.Ts, 10, 64); err == nil {
+		if ts > 1e12 {
+			return time.UnixMilli(ts), nil
+		}
+		return time.Unix(ts, 0), nil
+	}
+	return time.Parse(time.RFC3339, b.Ts)
+}
+
+// GetDnsQueriesReport fetches DNS query statistics per minute between startTs and endTs without additional headers.
+func (t *Client) GetDnsQueriesReport(ctx context.Context, stats_endpoint string, startTs, endTs time.Time) (*QueryStatsResponse, error) {
 	return t.sendDnsQueriesReportRequest(
-		stats_endpoint, t.buildDnsQueriesReportUri(DnsQueriesReportEndpoint), nil,
+		ctx, stats_endpoint, t.buildDnsQueriesReportUri(DnsQueriesReportEndpoint, startTs, endTs), nil,
 	)
 }
 
-// GetSubOrgDnsQueriesReport fetches DNS query statistics with additional headers for a specific organization.
-func (t *Client) GetSubOrgDnsQueriesReport(stats_endpoint string, orgID string) (*QueryStatsResponse, error) {
+// GetSubOrgDnsQueriesReport fetches DNS query statistics per minute between startTs and endTs with additional headers for a specific organization.
+func (t *Client) GetSubOrgDnsQueriesReport(ctx context.Context, stats_endpoint string, orgID string, startTs, endTs time.Time) (*QueryStatsResponse, error) {
 	return t.sendDnsQueriesReportRequest(
-		stats_endpoint, t.buildDnsQueriesReportUri(DnsQueriesReportEndpoint), t.buildOrgIDHeader(orgID),
+		ctx, stats_endpoint, t.buildDnsQueriesReportUri(DnsQueriesReportEndpoint, startTs, endTs), t.buildOrgIDHeader(orgID),
 	)
 }
 
 // sendDnsQueriesReportRequest sends a request to fetch DNS query statistics.
-func (t *Client) sendDnsQueriesReportRequest(stats_endpoint string, uri string, headers map[string]string) (*QueryStatsResponse, error) {
+func (t *Client) sendDnsQueriesReportRequest(ctx context.Context, stats_endpoint string, uri string, headers map[string]string) (*QueryStatsResponse, error) {
 	var data QueryStatsResponse
-	if err := t.sendReportAPIRequest(stats_endpoint, uri, headers, &data); err != nil {
+	if err := t.sendReportAPIRequest(ctx, stats_endpoint, uri, headers, &data); err != nil {
 		return nil, err
 	}
 	return &data, nil
 }
 
 // buildDnsQueriesReportUri constructs the URI for the DNS queries report.
-func (t *Client) buildDnsQueriesReportUri(baseEndpoint string) string {
+func (t *Client) buildDnsQueriesReportUri(baseEndpoint string, startTs, endTs time.Time) string {
 	return fmt.Sprintf(
-		"%s?startTs=%d&granularity=%s&tz=%s",
+		"%s?startTs=%d&endTs=%d&granularity=%s&tz=%s",
 		baseEndpoint,
-		time.Now().Add(-1*time.Minute).Unix(),
+		startTs.Unix(),
+		endTs.Unix(),
 		"minute",
 		time.Now().Location().String(),
 	)
 }
+
+// GetTopReport fetches the ranking of the report endpoint between startTs and endTs without additional headers.
+func (t *Client) GetTopReport(ctx context.Context, stats_endpoint string, endpoint string, startTs, endTs time.Time, limit int) (*CountsReportResponse, error) {
+	return t.sendCountsReportRequest(
+		ctx, stats_endpoint, t.buildTopReportUri(endpoint, startTs, endTs, limit), nil,
+	)
+}
+
+// GetSubOrgTopReport fetches the ranking of the report endpoint between startTs and endTs with additional headers for a specific organization.
+func (t *Client) GetSubOrgTopReport(ctx context.Context, stats_endpoint string, orgID string, endpoint string, startTs, endTs time.Time, limit int) (*CountsReportResponse, error) {
+	return t.sendCountsReportRequest(
+		ctx, stats_endpoint, t.buildTopReportUri(endpoint, startTs, endTs, limit), t.buildOrgIDHeader(orgID),
+	)
+}
+
+// GetBreakdownReport fetches the DNS queries of the report endpoint between startTs and endTs by key without additional headers.
+func (t *Client) GetBreakdownReport(ctx context.Context, stats_endpoint string, endpoint string, startTs, endTs time.Time) (*CountsReportResponse, error) {
+	return t.sendCountsReportRequest(
+		ctx, stats_endpoint, t.buildBreakdownReportUri(endpoint, startTs, endTs), nil,
+	)
+}
+
+// GetSubOrgBreakdownReport fetches the DNS queries of the report endpoint between startTs and endTs by key with additional headers for a specific organization.
+func (t *Client) GetSubOrgBreakdownReport(ctx context.Context, stats_endpoint string, orgID string, endpoint string, startTs, endTs time.Time) (*CountsReportResponse, error) {
+	return t.sendCountsReportRequest(
+		ctx, stats_endpoint, t.buildBreakdownReportUri(endpoint, startTs, endTs), t.buildOrgIDHeader(orgID),
+	)
+}
+
+// sendCountsReportRequest sends a request to fetch DNS queries counted by key.
+func (t *Client) sendCountsReportRequest(ctx context.Context, stats_endpoint string, uri string, headers map[string]string) (*CountsReportResponse, error) {
+	var data CountsReportResponse
+	if err := t.sendReportAPIRequest(ctx, stats_endpoint, uri, headers, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// buildTopReportUri constructs the URI for a ranking of DNS queries.
+func (t *Client) buildTopReportUri(baseEndpoint string, startTs, endTs time.Time, limit int) string {
+	return fmt.Sprintf(
+		"%s?startTs=%d&endTs=%d&limit=%d&tz=%s",
+		baseEndpoint,
+		startTs.Unix(),
+		endTs.Unix(),
+		limit,
+		time.Now().Location().String(),
+	)
+}
+
+// buildBreakdownReportUri constructs the URI for a breakdown of DNS queries.
+func (t *Client) buildBreakdownReportUri(baseEndpoint string, startTs, endTs time.Time) string {
+	return fmt.Sprintf(
+		"%s?startTs=%d&endTs=%d&tz=%s",
+		baseEndpoint,
+		startTs.Unix(),
+		endTs.Unix(),
+		time.Now().Location().String(),
+	)
+}
@@ -0,0 +1,107 @@
+// Package controld provides a client for interacting with the ControlD API.
+package controld
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how the client retries failed requests.
+type RetryPolicy struct {
+	MaxAttempts int           // Maximum number of attempts of a request, including the first one
+	MaxElapsed  time.Duration // Total time budget of all attempts of a request
+	BaseDelay   time.Duration // Upper bound of the delay before the first retry
+	MaxDelay    time.Duration // Upper bound of the delay between two attempts
+}
+
+// DefaultRetryPolicy is the retry policy used when none is configured.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	MaxElapsed:  30 * time.Second,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+}
+
+// WithRetryPolicy overrides the retry policy of the client.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(t *Client) {
+		t.retryPolicy = policy
+	}
+}
+
+// isRetryableMethod checks if the request can be sent again without side effects.
+func isRetryableMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+// isRetryableStatus checks if the HTTP status indicates a transient failure.
+// Authentication and authorization failures are never retried.
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// hasAttemptsLeft checks if the policy allows another attempt after the given number of attempts.
+func (p RetryPolicy) hasAttemptsLeft(attempts int) bool {
+	return attempts < p.MaxAttempts
+}
+
+// backoff returns the delay before the next attempt.
+// Retry-After is honoured when present, otherwise a jittered exponential delay is used.
+func (p RetryPolicy) backoff(attempts int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+
+	ceiling := p.BaseDelay << (attempts - 1)
+	if ceiling <= 0 || ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+
+	return rand.N(ceiling)
+}
+
+// parseRetryAfter parses the Retry-After header given either in seconds or as an HTTP date.
+func parseRetryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+
+	return 0
+}
+
+// sleepContext waits for the delay unless the context is done first.
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
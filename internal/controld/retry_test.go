@@ -0,0 +1,265 @@
+package controld
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testRetryPolicy retries quickly so that the tests do not wait for the default delays.
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	MaxElapsed:  5 * time.Second,
+	BaseDelay:   time.Millisecond,
+	MaxDelay:    10 * time.Millisecond,
+}
+
+// newTestClient returns a client sending its requests to the server without rate limit.
+func newTestClient(server *httptest.Server, policy RetryPolicy) *Client {
+	return NewClient(
+		"key",
+		WithBaseURL(server.URL),
+		WithRetryPolicy(policy),
+		WithRateLimit(RateLimit{}),
+	)
+}
+
+// newSequenceServer returns a server answering each request with the next response of the sequence.
+// The last response is repeated once the sequence is exhausted.
+func newSequenceServer(t *testing.T, responses []testResponse) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1)) - 1
+		resp := responses[min(n, len(responses)-1)]
+		for key, value := range resp.header {
+			w.Header().Set(key, value)
+		}
+		w.WriteHeader(resp.status)
+		_, _ = w.Write([]byte(resp.body))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+// testResponse is a response sent by the test server.
+type testResponse struct {
+	status int
+	header map[string]string
+	body   string
+}
+
+const (
+	devicesBody = `{"success":true,"body":{"devices":[]}}`
+	failureBody = `{"success":false,"error":{"code":50000,"message":"failure"}}`
+)
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	tests := []struct {
+		name       string
+		policy     RetryPolicy
+		attempts   int
+		retryAfter time.Duration
+		ceiling    time.Duration
+	}{
+		{name: "first retry", policy: policy, attempts: 1, ceiling: 100 * time.Millisecond},
+		{name: "exponential growth", policy: policy, attempts: 3, ceiling: 400 * time.Millisecond},
+		{name: "capped at the maximum delay", policy: policy, attempts: 10, ceiling: time.Second},
+		{name: "overflowing shift is capped", policy: policy, attempts: 100, ceiling: time.Second},
+		{name: "no delay configured", policy: RetryPolicy{}, attempts: 1, ceiling: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 100 {
+				delay := tt.policy.backoff(tt.attempts, tt.retryAfter)
+				if delay < 0 || (tt.ceiling == 0 && delay != 0) || (tt.ceiling > 0 && delay >= tt.ceiling) {
+					t.Fatalf("backoff(%d) = %s, want in [0, %s)", tt.attempts, delay, tt.ceiling)
+				}
+			}
+		})
+	}
+
+	t.Run("Retry-After takes precedence", func(t *testing.T) {
+		if delay := policy.backoff(10, 3*time.Second); delay != 3*time.Second {
+			t.Fatalf("backoff() = %s, want 3s", delay)
+		}
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{name: "missing", value: "", min: 0, max: 0},
+		{name: "seconds", value: "2", min: 2 * time.Second, max: 2 * time.Second},
+		{name: "zero seconds", value: "0", min: 0, max: 0},
+		{name: "negative seconds", value: "-5", min: 0, max: 0},
+		{name: "HTTP date", value: time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), min: 58 * time.Second, max: time.Minute},
+		{name: "HTTP date in the past", value: time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), min: -2 * time.Minute, max: 0},
+		{name: "invalid", value: "soon", min: 0, max: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.value != "" {
+				header.Set("Retry-After", tt.value)
+			}
+			if got := parseRetryAfter(header); got < tt.min || got > tt.max {
+				t.Fatalf("parseRetryAfter(%q) = %s, want in [%s, %s]", tt.value, got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestSendRequestRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []testResponse
+		attempts  int32
+		wantErr   any
+	}{
+		{
+			name:      "success on the first attempt",
+			responses: []testResponse{{status: http.StatusOK, body: devicesBody}},
+			attempts:  1,
+		},
+		{
+			name: "transient failures are retried",
+			responses: []testResponse{
+				{status: http.StatusServiceUnavailable, body: failureBody},
+				{status: http.StatusBadGateway, body: failureBody},
+				{status: http.StatusOK, body: devicesBody},
+			},
+			attempts: 3,
+		},
+		{
+			name:      "too many requests is retried",
+			responses: []testResponse{{status: http.StatusTooManyRequests, body: failureBody}, {status: http.StatusOK, body: devicesBody}},
+			attempts:  2,
+		},
+		{
+			name:      "attempts are bounded",
+			responses: []testResponse{{status: http.StatusInternalServerError, body: failureBody}},
+			attempts:  3,
+			wantErr:   new(*ServerError),
+		},
+		{
+			name:      "unauthorized is not retried",
+			responses: []testResponse{{status: http.StatusUnauthorized, body: failureBody}},
+			attempts:  1,
+			wantErr:   new(*UnauthorizedError),
+		},
+		{
+			name:      "forbidden is not retried",
+			responses: []testResponse{{status: http.StatusForbidden, body: failureBody}},
+			attempts:  1,
+			wantErr:   new(*ForbiddenError),
+		},
+		{
+			name:      "not found is not retried",
+			responses: []testResponse{{status: http.StatusNotFound, body: failureBody}},
+			attempts:  1,
+			wantErr:   new(*NotFoundError),
+		},
+		{
+			name:      "bad request is not retried",
+			responses: []testResponse{{status: http.StatusBadRequest, body: failureBody}},
+			attempts:  1,
+			wantErr:   new(*APIError),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := newSequenceServer(t, tt.responses)
+			client := newTestClient(server, testRetryPolicy)
+
+			_, err := client.GetDevices(context.Background())
+
+			if got := requests.Load(); got != tt.attempts {
+				t.Errorf("attempts = %d, want %d", got, tt.attempts)
+			}
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("GetDevices() error = %v, want nil", err)
+			}
+			if tt.wantErr != nil && !errors.As(err, tt.wantErr) {
+				t.Fatalf("GetDevices() error = %v (%T), want %T", err, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSendRequestHonoursRetryAfter(t *testing.T) {
+	server, requests := newSequenceServer(t, []testResponse{
+		{status: http.StatusTooManyRequests, header: map[string]string{"Retry-After": "1"}, body: failureBody},
+		{status: http.StatusOK, body: devicesBody},
+	})
+	client := newTestClient(server, testRetryPolicy)
+
+	start := time.Now()
+	if _, err := client.GetDevices(context.Background()); err != nil {
+		t.Fatalf("GetDevices() error = %v, want nil", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("elapsed = %s, want at least the 1s requested by Retry-After", elapsed)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("attempts = %d, want 2", got)
+	}
+}
+
+func TestSendRequestMaxElapsed(t *testing.T) {
+	server, requests := newSequenceServer(t, []testResponse{
+		{status: http.StatusTooManyRequests, header: map[string]string{"Retry-After": "10"}, body: failureBody},
+	})
+	policy := testRetryPolicy
+	policy.MaxElapsed = time.Second
+	client := newTestClient(server, policy)
+
+	start := time.Now()
+	_, err := client.GetDevices(context.Background())
+
+	var rateLimited *RateLimitedError
+	if !errors.As(err, &rateLimited) {
+		t.Fatalf("GetDevices() error = %v, want *RateLimitedError", err)
+	}
+	if rateLimited.RetryAfter != 10*time.Second {
+		t.Errorf("RetryAfter = %s, want 10s", rateLimited.RetryAfter)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("elapsed = %s, want the retry to be given up without waiting", elapsed)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("attempts = %d, want 1", got)
+	}
+}
+
+func TestSendRequestStopsOnCanceledContext(t *testing.T) {
+	server, requests := newSequenceServer(t, []testResponse{{status: http.StatusServiceUnavailable, body: failureBody}})
+	policy := testRetryPolicy
+	policy.BaseDelay, policy.MaxDelay, policy.MaxElapsed = time.Hour, time.Hour, 2*time.Hour
+	client := newTestClient(server, policy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := client.GetDevices(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetDevices() error = %v, want context.DeadlineExceeded", err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("attempts = %d, want 1", got)
+	}
+}
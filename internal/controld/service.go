@@ -1,6 +1,8 @@
 // Package controld provides a client for interacting with the ControlD API.
 package controld
 
+import "context"
+
 const (
 	ServiceCategoriesEndpoint = "/services/categories" // Endpoint for retrieving service categories
 )
@@ -19,19 +21,19 @@ type ServiceCategoriesResponse struct {
 }
 
 // GetServiceCategories retrieves service categories without additional headers.
-func (t *Client) GetServiceCategories() (*ServiceCategoriesResponse, error) {
-	return t.sendServiceCategoriesRequest(nil)
+func (t *Client) GetServiceCategories(ctx context.Context) (*ServiceCategoriesResponse, error) {
+	return t.sendServiceCategoriesRequest(ctx, nil)
 }
 
 // GetSubOrgServiceCategories retrieves service categories with additional headers for a specific organization.
-func (t *Client) GetSubOrgServiceCategories(orgID string) (*ServiceCategoriesResponse, error) {
-	return t.sendServiceCategoriesRequest(t.buildOrgIDHeader(orgID))
+func (t *Client) GetSubOrgServiceCategories(ctx context.Context, orgID string) (*ServiceCategoriesResponse, error) {
+	return t.sendServiceCategoriesRequest(ctx, t.buildOrgIDHeader(orgID))
 }
 
 // sendServiceCategoriesRequest sends a request to fetch service categories.
-func (t *Client) sendServiceCategoriesRequest(headers map[string]string) (*ServiceCategoriesResponse, error) {
+func (t *Client) sendServiceCategoriesRequest(ctx context.Context, headers map[string]string) (*ServiceCategoriesResponse, error) {
 	var data ServiceCategoriesResponse
-	err := t.sendAPIRequest(ServiceCategoriesEndpoint, headers, &data)
+	err := t.sendAPIRequest(ctx, ServiceCategoriesEndpoint, headers, &data)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,74 @@
+// Package log provides a simple logging interface.
+package log
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/sirupsen/logrus"
+)
+
+// slogHandler forwards the records of log/slog to the logger, for libraries which log with log/slog.
+type slogHandler struct {
+	fields logrus.Fields // Attributes added to every record
+	group  string        // Prefix of the keys of the attributes
+}
+
+// Slog returns a log/slog logger which writes to the logger with its level and format.
+func Slog() *slog.Logger {
+	return slog.New(&slogHandler{fields: logrus.Fields{}})
+}
+
+// Enabled checks if the logger writes records of the level.
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return logger.IsLevelEnabled(toLogrusLevel(level))
+}
+
+// Handle writes the record to the logger.
+func (h *slogHandler) Handle(_ context.Context, r slog.Record) error {
+	fields := logrus.Fields{}
+	for key, value := range h.fields {
+		fields[key] = value
+	}
+	r.Attrs(func(attr slog.Attr) bool {
+		fields[h.group+attr.Key] = attr.Value.Any()
+		return true
+	})
+
+	logger.WithFields(fields).Log(toLogrusLevel(r.Level), r.Message)
+	return nil
+}
+
+// WithAttrs returns a handler which adds the attributes to every record.
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := logrus.Fields{}
+	for key, value := range h.fields {
+		fields[key] = value
+	}
+	for _, attr := range attrs {
+		fields[h.group+attr.Key] = attr.Value.Any()
+	}
+	return &slogHandler{fields: fields, group: h.group}
+}
+
+// WithGroup returns a handler which prefixes the keys of the subsequent attributes with the group.
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &slogHandler{fields: h.fields, group: h.group + name + "."}
+}
+
+// toLogrusLevel converts the level of log/slog to the level of logrus.
+func toLogrusLevel(level slog.Level) logrus.Level {
+	switch {
+	case level >= slog.LevelError:
+		return logrus.ErrorLevel
+	case level >= slog.LevelWarn:
+		return logrus.WarnLevel
+	case level >= slog.LevelInfo:
+		return logrus.InfoLevel
+	default:
+		return logrus.DebugLevel
+	}
+}
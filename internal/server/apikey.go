@@ -0,0 +1,96 @@
+// Package server provides the HTTP server implementation for the exporter.
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/umatare5/controld-exporter/internal/config"
+	"github.com/umatare5/controld-exporter/internal/controld"
+	"github.com/umatare5/controld-exporter/internal/log"
+)
+
+const (
+	apiKeyFileCheckInterval = 10 * time.Second // Interval to check the API key file for a rotated key
+)
+
+// apiKeyFile is an API key file watched for rotated keys, with the clients authenticated by its key.
+type apiKeyFile struct {
+	path    string             // Path of the file
+	apiKey  string             // Key read from the file the last time
+	clients []*controld.Client // Clients using the key
+}
+
+// apiKeyUser is a client with the source of its API key.
+type apiKeyUser struct {
+	path   string           // Path of the API key file, or empty when the key is given directly
+	apiKey string           // Key used by the client
+	client *controld.Client // Client using the key
+}
+
+// groupAPIKeyFiles groups the clients by API key file. Clients given the key of a watched file directly are grouped
+// with the file too, as they authenticate as the same account and would keep the old key after a rotation.
+func groupAPIKeyFiles(users []apiKeyUser) []*apiKeyFile {
+	files := []*apiKeyFile{}
+	byPath := map[string]*apiKeyFile{}
+	for _, user := range users {
+		if user.path == "" {
+			continue
+		}
+		file, ok := byPath[user.path]
+		if !ok {
+			file = &apiKeyFile{path: user.path, apiKey: user.apiKey}
+			byPath[user.path] = file
+			files = append(files, file)
+		}
+		file.clients = append(file.clients, user.client)
+	}
+
+	for _, user := range users {
+		if user.path != "" {
+			continue
+		}
+		for _, file := range files {
+			if file.apiKey == user.apiKey {
+				file.clients = append(file.clients, user.client)
+				break
+			}
+		}
+	}
+
+	return files
+}
+
+// watch checks the API key file for a rotated key on every tick until the context is done.
+func (f *apiKeyFile) watch(ctx context.Context) {
+	ticker := time.NewTicker(apiKeyFileCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f.check()
+		}
+	}
+}
+
+// check re-reads the API key file and swaps a rotated key into every client using it.
+// The current key is kept when the file cannot be read, e.g. while a secret mount is being updated.
+func (f *apiKeyFile) check() {
+	rotated, err := config.ReadAPIKeyFile(f.path)
+	if err != nil {
+		log.Warnf("Failed to re-read the API key file %s, keeping the current key: %v", f.path, err)
+		return
+	}
+	if rotated == f.apiKey {
+		return
+	}
+
+	for _, client := range f.clients {
+		client.SetAPIKey(rotated)
+	}
+	f.apiKey = rotated
+	log.Infof("Loaded the rotated API key from %s into %d client(s).", f.path, len(f.clients))
+}
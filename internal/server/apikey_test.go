@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/umatare5/controld-exporter/internal/config"
+	"github.com/umatare5/controld-exporter/internal/controld"
+)
+
+func TestGroupAPIKeyFiles(t *testing.T) {
+	clients := make([]*controld.Client, 5)
+	for i := range clients {
+		clients[i] = controld.NewClient("key")
+	}
+
+	tests := []struct {
+		name  string
+		users []apiKeyUser
+		want  map[string][]int // Indexes of the clients grouped with each file
+	}{
+		{
+			name:  "no file",
+			users: []apiKeyUser{{apiKey: "key-a", client: clients[0]}},
+			want:  map[string][]int{},
+		},
+		{
+			name: "clients sharing a file",
+			users: []apiKeyUser{
+				{path: "/a", apiKey: "key-a", client: clients[0]},
+				{path: "/a", apiKey: "key-a", client: clients[1]},
+				{path: "/b", apiKey: "key-b", client: clients[2]},
+			},
+			want: map[string][]int{"/a": {0, 1}, "/b": {2}},
+		},
+		{
+			name: "clients given the key of a file directly",
+			users: []apiKeyUser{
+				{apiKey: "key-a", client: clients[0]},
+				{path: "/a", apiKey: "key-a", client: clients[1]},
+				{apiKey: "key-b", client: clients[2]},
+				{path: "/b", apiKey: "key-b", client: clients[3]},
+				{apiKey: "key-c", client: clients[4]},
+			},
+			want: map[string][]int{"/a": {1, 0}, "/b": {3, 2}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := groupAPIKeyFiles(tt.users)
+
+			if len(files) != len(tt.want) {
+				t.Fatalf("groupAPIKeyFiles() = %d files, want %d", len(files), len(tt.want))
+			}
+			for _, file := range files {
+				want := []*controld.Client{}
+				for _, i := range tt.want[file.path] {
+					want = append(want, clients[i])
+				}
+				if !slices.Equal(file.clients, want) {
+					t.Errorf("clients of %s = %v, want %v", file.path, file.clients, want)
+				}
+			}
+		})
+	}
+}
+
+// keyRecorder is a server recording the API key of the last request.
+type keyRecorder struct {
+	*httptest.Server
+	mu     sync.Mutex
+	apiKey string
+}
+
+// newKeyRecorder returns a server recording the API key of the last request.
+func newKeyRecorder(t *testing.T) *keyRecorder {
+	t.Helper()
+
+	recorder := &keyRecorder{}
+	recorder.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder.mu.Lock()
+		recorder.apiKey = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		recorder.mu.Unlock()
+		_, _ = w.Write([]byte(`{"success":true,"body":{}}`))
+	}))
+	t.Cleanup(recorder.Close)
+
+	return recorder
+}
+
+// apiKeyOf returns the API key the client sends.
+func (r *keyRecorder) apiKeyOf(t *testing.T, client *controld.Client) string {
+	t.Helper()
+
+	if _, err := client.GetNetwork(context.Background()); err != nil {
+		t.Fatalf("GetNetwork() error = %v", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.apiKey
+}
+
+func TestAPIKeyFileCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		content *string // Content of the file at the check, or nil to remove it
+		want    string
+	}{
+		{name: "rotated key", content: ptr("key-b\n"), want: "key-b"},
+		{name: "unchanged key", content: ptr("key-a"), want: "key-a"},
+		{name: "empty file", content: ptr(""), want: "key-a"},
+		{name: "removed file", want: "key-a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newKeyRecorder(t)
+			path := filepath.Join(t.TempDir(), "key")
+			if err := os.WriteFile(path, []byte("key-a"), 0o600); err != nil {
+				t.Fatalf("WriteFile() error = %v", err)
+			}
+			fromFile := controld.NewClient("key-a", controld.WithBaseURL(server.URL))
+			direct := controld.NewClient("key-a", controld.WithBaseURL(server.URL))
+			other := controld.NewClient("key-c", controld.WithBaseURL(server.URL))
+			files := groupAPIKeyFiles([]apiKeyUser{
+				{path: path, apiKey: "key-a", client: fromFile},
+				{apiKey: "key-a", client: direct},
+				{apiKey: "key-c", client: other},
+			})
+
+			if tt.content == nil {
+				if err := os.Remove(path); err != nil {
+					t.Fatalf("Remove() error = %v", err)
+				}
+			} else if err := os.WriteFile(path, []byte(*tt.content), 0o600); err != nil {
+				t.Fatalf("WriteFile() error = %v", err)
+			}
+			files[0].check()
+
+			if got := server.apiKeyOf(t, fromFile); got != tt.want {
+				t.Errorf("API key of the client of the file = %q, want %q", got, tt.want)
+			}
+			if got := server.apiKeyOf(t, direct); got != tt.want {
+				t.Errorf("API key of the client given the key directly = %q, want %q", got, tt.want)
+			}
+			if got := server.apiKeyOf(t, other); got != "key-c" {
+				t.Errorf("API key of the client of another key = %q, want %q", got, "key-c")
+			}
+			if files[0].apiKey != tt.want {
+				t.Errorf("apiKey = %q, want %q", files[0].apiKey, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewServerWatchesProbeTargetsWithAPIKeyFile(t *testing.T) {
+	server := newKeyRecorder(t)
+	path := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(path, []byte("key-a"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	s, err := NewServer(&config.Config{
+		ControlDAPIKey:           "key-a",
+		ControlDAPIKeyFile:       path,
+		ControlDAPIURL:           server.URL,
+		ControlDRetryMaxAttempts: 1,
+		ControlDRateBurst:        1,
+		ProbeTargets: map[string]config.ProbeTarget{
+			"from-file": {APIKey: "key-a", APIKeyFile: path, Mode: config.PersonalMode},
+			"direct":    {APIKey: "key-a", Mode: config.PersonalMode},
+			"other":     {APIKey: "key-c", Mode: config.PersonalMode},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	if len(s.keyFiles) != 1 {
+		t.Fatalf("watched files = %d, want 1", len(s.keyFiles))
+	}
+	if clients := s.keyFiles[0].clients; len(clients) != 3 || !slices.Contains(clients, s.Client) {
+		t.Errorf("clients of %s = %d, want the main client and the 2 probe targets using its key", path, len(clients))
+	}
+
+	if err := os.WriteFile(path, []byte("key-b"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	s.keyFiles[0].check()
+
+	if got := server.apiKeyOf(t, s.Client); got != "key-b" {
+		t.Errorf("API key of the main client = %q, want the rotated key %q", got, "key-b")
+	}
+	for _, client := range s.keyFiles[0].clients {
+		if got := server.apiKeyOf(t, client); got != "key-b" {
+			t.Errorf("API key of a client of the file = %q, want the rotated key %q", got, "key-b")
+		}
+	}
+}
+
+// ptr returns a pointer to the value.
+func ptr[T any](value T) *T {
+	return &value
+}
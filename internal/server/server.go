@@ -2,8 +2,14 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"html"
+	"maps"
 	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -11,28 +17,140 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/exporter-toolkit/web"
 	"github.com/umatare5/controld-exporter/internal/collector"
 	"github.com/umatare5/controld-exporter/internal/config"
 	"github.com/umatare5/controld-exporter/internal/controld"
 	"github.com/umatare5/controld-exporter/internal/log"
 )
 
+const (
+	scrapeTimeoutHeader = "X-Prometheus-Scrape-Timeout-Seconds" // Header holding the scrape timeout of Prometheus
+	scrapeTimeoutOffset = 500 * time.Millisecond                // Time subtracted from the scrape timeout to write the response
+	collectParam        = "collect[]"                           // Query parameter selecting the collector modules to serve
+	targetParam         = "target"                              // Query parameter selecting the account served by the probe endpoint
+	probePath           = "/probe"                              // Path of the probe endpoint
+	healthyPath         = "/-/healthy"                          // Path of the liveness endpoint
+	readyPath           = "/-/ready"                            // Path of the readiness endpoint
+)
+
 // Server represents the HTTP server for the exporter.
 type Server struct {
-	Client *controld.Client // ControlD API client
-	Config *config.Config   // Configuration for the server
+	Client    *controld.Client                // ControlD API client, or nil when only the probe endpoint is served
+	Collector *collector.Collector            // Collector serving the metrics polled in the background, or nil when only the probe endpoint is served
+	Probes    map[string]*collector.Collector // Collectors of the accounts served by the probe endpoint, keyed by target name
+	Config    *config.Config                  // Configuration for the server
+	keyFiles  []*apiKeyFile                   // API key files watched for rotated keys, with the clients using them
+	validated chan struct{}                   // Closed once the API key has been validated
 }
 
 // NewServer initializes and returns a new Server instance.
 func NewServer(config *config.Config) (Server, error) {
-	return Server{
-		Client: controld.NewClient(config.ControlDAPIKey),
-		Config: config,
-	}, nil
+	s := Server{Config: config, validated: make(chan struct{})}
+	probes, users := buildProbeCollectors(config)
+	s.Probes = probes
+
+	// Without API key, the exporter only serves the targets of the probe endpoint.
+	if config.ControlDAPIKey == "" {
+		s.keyFiles = groupAPIKeyFiles(users)
+		return s, nil
+	}
+
+	s.Client = controld.NewClient(config.ControlDAPIKey, buildClientOptions(config)...)
+	s.keyFiles = groupAPIKeyFiles(append(users, apiKeyUser{path: config.ControlDAPIKeyFile, apiKey: config.ControlDAPIKey, client: s.Client}))
+	s.Collector = collector.NewCollector(s.Client, collector.Options{
+		Mode:             config.ControlDMode,
+		RefreshIntervals: config.RefreshIntervals,
+		EnabledModules:   config.EnabledModules,
+		MaxConcurrency:   config.CollectorMaxConcurrency,
+		Top:              buildTopOptions(config),
+		ClientLimit:      config.CollectorClientLimit,
+	})
+	return s, nil
+}
+
+// buildProbeCollectors initializes a client and a collector for each target of the probe endpoint, and returns the
+// collectors with the source of the API key of each client.
+// The targets share the settings of the flags except for the API key, the mode and the modules.
+func buildProbeCollectors(config *config.Config) (map[string]*collector.Collector, []apiKeyUser) {
+	probes := map[string]*collector.Collector{}
+	users := []apiKeyUser{}
+	for name, target := range config.ProbeTargets {
+		client := controld.NewClient(target.APIKey, buildClientOptions(config)...)
+		users = append(users, apiKeyUser{path: target.APIKeyFile, apiKey: target.APIKey, client: client})
+		probes[name] = collector.NewCollector(client, collector.Options{
+			Mode:             target.Mode,
+			RefreshIntervals: config.RefreshIntervals,
+			EnabledModules:   target.EnabledModules(),
+			MaxConcurrency:   config.CollectorMaxConcurrency,
+			Top:              buildTopOptions(config),
+			ClientLimit:      config.CollectorClientLimit,
+		})
+	}
+	return probes, users
+}
+
+// buildTopOptions converts the configuration into the settings of the stats_top collector module.
+func buildTopOptions(config *config.Config) collector.TopOptions {
+	return collector.TopOptions{
+		Window:        config.CollectorTopWindow,
+		Limit:         config.CollectorTopLimit,
+		DomainInclude: compileRegexp(config.CollectorTopDomainInclude),
+		DomainExclude: compileRegexp(config.CollectorTopDomainExclude),
+	}
+}
+
+// compileRegexp compiles the regular expression, or returns nil when it is empty.
+func compileRegexp(expr string) *regexp.Regexp {
+	if expr == "" {
+		return nil
+	}
+	return regexp.MustCompile(expr) // Validated in config.NewConfig
+}
+
+// buildClientOptions converts the configuration into options for the ControlD API client.
+func buildClientOptions(config *config.Config) []controld.Option {
+	opts := []controld.Option{
+		controld.WithBaseURL(config.ControlDAPIURL),
+		controld.WithAnalyticsURL(config.ControlDAnalyticsURL),
+		controld.WithUserAgent(config.ControlDUserAgent),
+		controld.WithTimeout(config.ControlDTimeout),
+		controld.WithRetryPolicy(controld.RetryPolicy{
+			MaxAttempts: config.ControlDRetryMaxAttempts,
+			MaxElapsed:  config.ControlDRetryMaxElapsed,
+			BaseDelay:   controld.DefaultRetryPolicy.BaseDelay,
+			MaxDelay:    controld.DefaultRetryPolicy.MaxDelay,
+		}),
+		controld.WithRateLimit(controld.RateLimit{
+			RequestsPerSecond: config.ControlDRateLimit,
+			Burst:             config.ControlDRateBurst,
+		}),
+		controld.WithAnalyticsRateLimit(controld.RateLimit{
+			RequestsPerSecond: config.ControlDAnalyticsRateLimit,
+			Burst:             config.ControlDAnalyticsRateBurst,
+		}),
+	}
+
+	if config.ControlDProxyURL != "" {
+		opts = append(opts, controld.WithHTTPClient(newProxyHTTPClient(config.ControlDProxyURL)))
+	}
+
+	return opts
+}
+
+// newProxyHTTPClient returns an HTTP client which sends every request through the proxy.
+func newProxyHTTPClient(proxyURL string) *http.Client {
+	proxy, _ := url.Parse(proxyURL) // Validated in config.NewConfig
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxy)
+
+	return &http.Client{Transport: transport}
 }
 
 // Start configures and launches the HTTP server to serve metrics and help pages.
-func (s *Server) Start() {
+// When the context is canceled, the server stops accepting connections and drains the in-flight requests.
+func (s *Server) Start(ctx context.Context) error {
 	log.SetLogLevel(s.Config.LogLevel)
 	reg := prometheus.NewRegistry()
 
@@ -42,47 +160,194 @@ func (s *Server) Start() {
 		collectors.NewGoCollector(),
 	)
 
+	for _, file := range s.keyFiles {
+		go file.watch(ctx)
+	}
+	for _, probe := range s.Probes {
+		probe.Start(ctx)
+	}
+
 	// Register HTTP handlers.
-	http.HandleFunc("/", s.help)
-	http.HandleFunc(s.Config.WebTelemetryPath, func(w http.ResponseWriter, r *http.Request) {
-		s.metricsHandler(w, r)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.help)
+	mux.HandleFunc(s.Config.WebTelemetryPath, func(w http.ResponseWriter, r *http.Request) {
+		s.metricsHandler(w, r, reg)
 	})
+	mux.HandleFunc(probePath, s.probeHandler)
+	mux.HandleFunc(healthyPath, s.healthy)
+	mux.HandleFunc(readyPath, s.ready)
 
 	// Print server start message.
-	log.Infof(
-		"Starting the %s exporter on port %d.",
-		map[bool]string{true: "business mode", false: "personal mode"}[s.Config.ControlDBusinessMode],
-		s.Config.WebListenPort,
-	)
+	log.Infof("Starting the %s mode exporter on port %d.", s.Config.ControlDMode, s.Config.WebListenPort)
 
 	srv := &http.Server{
 		Addr:         s.Config.WebListenAddress + ":" + strconv.Itoa(s.Config.WebListenPort),
-		Handler:      nil,
+		Handler:      mux,
 		ReadTimeout:  time.Minute,
 		WriteTimeout: time.Minute,
 	}
 
-	if err := srv.ListenAndServe(); err != nil {
-		log.Fatal("Failed to start server: ", err)
+	// Serve TLS and authentication as configured in the web configuration file, if any.
+	systemdSocket := false
+	flags := &web.FlagConfig{
+		WebListenAddresses: &[]string{srv.Addr},
+		WebSystemdSocket:   &systemdSocket,
+		WebConfigFile:      &s.Config.WebConfigFile,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- web.ListenAndServe(srv, flags, log.Slog())
+	}()
+
+	// Validate the API key while already listening, so that liveness probes succeed during the retries.
+	// Only /-/ready waits for the validation, and the exporter exits when the API key is rejected.
+	validateCh := make(chan error, 1)
+	go func() {
+		validateCh <- s.validateAndStart(ctx)
+	}()
+
+	var runErr error
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("failed to start server: %w", err)
+	case runErr = <-validateCh:
+		if runErr == nil {
+			select {
+			case err := <-errCh:
+				return fmt.Errorf("failed to start server: %w", err)
+			case <-ctx.Done():
+			}
+		}
+	case <-ctx.Done():
+	}
+
+	log.Infof("Shutting down the exporter, waiting up to %s for in-flight requests.", s.Config.WebShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.Config.WebShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down server: %w", err)
+	}
+	return runErr
+}
+
+// validateAndStart validates the API key and then starts polling the ControlD API in the background.
+// It returns an error only when the API key is rejected.
+func (s *Server) validateAndStart(ctx context.Context) error {
+	if s.Collector != nil {
+		if err := s.validate(ctx); err != nil {
+			return err
+		}
+		s.Collector.Start(ctx)
+	}
+	close(s.validated)
+	return nil
+}
+
+// healthy reports that the process is alive.
+func (s *Server) healthy(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte("Healthy.\n")); err != nil {
+		log.Errorf("Error writing response: %v", err)
 	}
 }
 
-// metricsHandler registers Prometheus metrics and serves them via HTTP.
-func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+// ready reports whether the API key has been validated and the exporter has collected metrics successfully.
+func (s *Server) ready(w http.ResponseWriter, _ *http.Request) {
+	status, body := http.StatusOK, "Ready.\n"
+	select {
+	case <-s.validated:
+	default:
+		status, body = http.StatusServiceUnavailable, "Not ready: validating the API key.\n"
+	}
+	if status == http.StatusOK && s.Collector != nil && !s.Collector.IsReady() {
+		status, body = http.StatusServiceUnavailable, "Not ready: no successful collection yet.\n"
+	}
+
+	w.WriteHeader(status)
+	if _, err := w.Write([]byte(body)); err != nil {
+		log.Errorf("Error writing response: %v", err)
+	}
+}
+
+// metricsHandler registers the ControlD collector bound to the scrape and serves the metrics via HTTP.
+func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request, reg *prometheus.Registry) {
+	ctx, cancel := scrapeContext(r)
+	defer cancel()
+
 	registry := prometheus.NewRegistry()
 
-	// Register the ControlD collector and metrics.
-	registry.MustRegister(
-		collector.NewCollector(s.Client, s.Config.ControlDBusinessMode),
-	)
+	// Without API key, only the metrics of the process are served here.
+	if s.Collector != nil {
+		// Serve only the modules requested by the collect[] parameter, if any.
+		c, err := s.Collector.ForScrape(ctx, r.URL.Query()[collectParam]...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Register the ControlD collector and metrics.
+		registry.MustRegister(c)
+	}
 
 	// Serve metrics using Prometheus client library.
+	h := promhttp.HandlerFor(prometheus.Gatherers{reg, registry}, promhttp.HandlerOpts{
+		ErrorHandling: promhttp.ContinueOnError,
+	})
+	h.ServeHTTP(w, r)
+}
+
+// probeHandler serves the metrics of the account selected by the target parameter.
+func (s *Server) probeHandler(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get(targetParam)
+	if target == "" {
+		http.Error(w, "Target parameter is missing", http.StatusBadRequest)
+		return
+	}
+
+	probe, ok := s.Probes[target]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown probe target %q", target), http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := scrapeContext(r)
+	defer cancel()
+
+	// Serve only the modules requested by the collect[] parameter, if any.
+	c, err := probe.ForScrape(ctx, r.URL.Query()[collectParam]...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+
 	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{
 		ErrorHandling: promhttp.ContinueOnError,
 	})
 	h.ServeHTTP(w, r)
 }
 
+// scrapeContext derives the context of the scrape from the timeout announced by Prometheus.
+// The context is canceled when the client goes away even if no timeout is announced.
+func scrapeContext(r *http.Request) (context.Context, context.CancelFunc) {
+	seconds, err := strconv.ParseFloat(r.Header.Get(scrapeTimeoutHeader), 64)
+	if err != nil || seconds <= 0 {
+		return context.WithCancel(r.Context())
+	}
+
+	// Leave some room to write the response before Prometheus gives up.
+	timeout := time.Duration(seconds*float64(time.Second)) - scrapeTimeoutOffset
+	if timeout <= 0 {
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+
+	return context.WithTimeout(r.Context(), timeout)
+}
+
 // help generates and serves an HTML help page for the root URL.
 func (s *Server) help(w http.ResponseWriter, _ *http.Request) {
 	listenAddrAndPort := s.Config.WebListenAddress + ":" + strconv.Itoa(s.Config.WebListenPort)
@@ -96,6 +361,16 @@ func (s *Server) help(w http.ResponseWriter, _ *http.Request) {
 	builder.WriteString(fmt.Sprintf("<li><a href=\"http://%s%s\">http://%s%s</a></li>", listenAddrAndPort, s.Config.WebTelemetryPath, listenAddrAndPort, s.Config.WebTelemetryPath))
 	builder.WriteString("</ul>")
 
+	if len(s.Probes) > 0 {
+		builder.WriteString("<p>To fetch metrics of the accounts defined in the probe configuration, access the probe path with a target:</p>")
+		builder.WriteString("<ul>")
+		for _, target := range slices.Sorted(maps.Keys(s.Probes)) {
+			probeURL := fmt.Sprintf("http://%s%s?%s=%s", listenAddrAndPort, probePath, targetParam, url.QueryEscape(target))
+			builder.WriteString(fmt.Sprintf("<li><a href=\"%s\">%s</a></li>", probeURL, html.EscapeString(probeURL)))
+		}
+		builder.WriteString("</ul>")
+	}
+
 	if _, err := w.Write([]byte(builder.String())); err != nil {
 		log.Errorf("Error writing response: %v", err)
 	}
@@ -0,0 +1,76 @@
+// Package server provides the HTTP server implementation for the exporter.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/umatare5/controld-exporter/internal/collector"
+	"github.com/umatare5/controld-exporter/internal/config"
+	"github.com/umatare5/controld-exporter/internal/controld"
+	"github.com/umatare5/controld-exporter/internal/log"
+)
+
+const (
+	validationTimeout = time.Minute // Time budget of the requests sent to validate the API key at startup
+)
+
+// validate checks the API key and the plan of the account before collecting metrics.
+// Only a rejected API key is fatal. When the API cannot be reached, the exporter starts anyway.
+func (s *Server) validate(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, validationTimeout)
+	defer cancel()
+
+	v, err := s.Collector.Validate(ctx)
+
+	var unauthorized *controld.UnauthorizedError
+	if errors.As(err, &unauthorized) {
+		return fmt.Errorf("the API key was rejected by the Control D API: %w", err)
+	}
+	if err != nil {
+		log.Warnf("Failed to validate the API key, starting anyway: %v", err)
+		return nil
+	}
+
+	s.warnModeMismatch(v)
+	logEntitlements(v)
+	return nil
+}
+
+// warnModeMismatch warns when the mode disagrees with the account of the API key.
+// In auto mode, the mode follows the account and nothing is reported.
+func (s *Server) warnModeMismatch(v *collector.Validation) {
+	if v.BusinessAccount && s.Config.ControlDMode == config.PersonalMode {
+		log.Warnf(
+			"The API key belongs to the business organization %s, but '--%s' is %s. "+
+				"Metrics are labeled with orgId 000000000 and the organization metrics are not collected.",
+			v.OrganizationID, config.ControlDModeFlagName, config.PersonalMode,
+		)
+	}
+	if !v.BusinessAccount && s.Config.ControlDMode == config.BusinessMode {
+		log.Warnf(
+			"The API key does not belong to a business organization, but '--%s' is %s. "+
+				"The collection of most modules will fail.",
+			config.ControlDModeFlagName, config.BusinessMode,
+		)
+	}
+}
+
+// logEntitlements reports the modules included in the plan of the account and why the others failed.
+func logEntitlements(v *collector.Validation) {
+	entitled := []string{}
+	for name, err := range v.Entitlements {
+		if err == nil {
+			entitled = append(entitled, name)
+			continue
+		}
+		log.Warnf("The %s module is not available for the API key: %v", name, err)
+	}
+	slices.Sort(entitled)
+
+	log.Infof("Validated the API key. Available modules: %s.", strings.Join(entitled, ", "))
+}